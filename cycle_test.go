@@ -0,0 +1,239 @@
+package loc
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+// Return the sentences of a cycle at 12:35:s, with GGA and RMC times
+// written differently.
+func cycle(s int) []string {
+	return []string{
+		nmea(fmt.Sprintf("GPGGA,1235%02d,4807.038,N,01131.000,E,1,08,0.9,545.4,M,46.9,M,,", s)),
+		nmea(fmt.Sprintf("GPRMC,1235%02d.00,A,4807.038,N,01131.000,E,022.4,084.4,230394,003.1,W", s)),
+		nmea("GPGSA,A,3,04,05,,09,12,,,24,,,,,2.5,1.3,2.1"),
+	}
+}
+
+// Feed cycle s, and wait 1 s.
+func feedCycle(d *Decoder, clk *fakeClock, s int) {
+	for _, ss := range cycle(s) {
+		d.FeedAt([]byte(ss), clk.Now())
+		clk.t = clk.t.Add(10 * time.Millisecond)
+	}
+	clk.t = clk.t.Add(time.Second)
+}
+
+// Feed n cycles and return the fixes delivered so far.
+func feedCycles(d *Decoder, clk *fakeClock, n int) (fixes []*LocInfo) {
+	for s := 0; s < n; s++ {
+		feedCycle(d, clk, s)
+	}
+	for {
+		select {
+		case li := <-d.Fixes():
+			fixes = append(fixes, li)
+		default:
+			return
+		}
+	}
+}
+
+func TestDelivery(t *testing.T) {
+	tests := []struct {
+		name     string
+		delivery int
+		bufSize  int
+		dropped  uint64
+		first    uint16 // second of the fix received
+	}{
+		{"drop newest", LOC_DELIVER_DROP_NEWEST, 1, 2, 0},
+		{"drop oldest", LOC_DELIVER_DROP_OLDEST, 1, 2, 2},
+		{"drop oldest, unbuffered", LOC_DELIVER_DROP_OLDEST, 0, 3, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clk := &fakeClock{time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)}
+			d := NewDecoder(Options{Lsdt: "GPGSA", Clock: clk, BufSize: tt.bufSize, Delivery: tt.delivery})
+			fixes := feedCycles(d, clk, 3)
+			if n := d.Dropped(); n != tt.dropped {
+				t.Errorf("got %d dropped fixes, want %d", n, tt.dropped)
+			}
+			if len(fixes) != 3-int(tt.dropped) || (len(fixes) != 0 && fixes[0].Utc.Second != tt.first) {
+				t.Errorf("got %d fixes", len(fixes))
+			}
+		})
+	}
+}
+
+func TestDeliverBlock(t *testing.T) {
+	clk := &fakeClock{time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)}
+	d := NewDecoder(Options{Lsdt: "GPGSA", Clock: clk, BufSize: 2})
+	feedCycle(d, clk, 0)
+	feedCycle(d, clk, 1)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		feedCycle(d, clk, 2) // blocked, the channel is full
+	}()
+	time.Sleep(50 * time.Millisecond)
+	select {
+	case <-done:
+		t.Fatal("delivery not blocked")
+	default:
+	}
+
+	// Rate must not wait for the blocked delivery.
+	rate := make(chan float64)
+	go func() { rate <- d.Rate() }()
+	select {
+	case r := <-rate:
+		if r != 1 {
+			t.Errorf("got rate %v, want 1", r)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Rate blocked by a pending delivery")
+	}
+
+	// The fixes are received in order.
+	for i := 0; i < 3; i++ {
+		if li := <-d.Fixes(); li.Utc.Second != uint16(i) {
+			t.Errorf("got fix %d at %+v", i, li.Utc)
+		}
+	}
+	<-done
+
+	// Close releases a blocked delivery.
+	feedCycle(d, clk, 3)
+	feedCycle(d, clk, 4)
+	done = make(chan struct{})
+	go func() {
+		defer close(done)
+		feedCycle(d, clk, 5)
+	}()
+	time.Sleep(50 * time.Millisecond)
+	d.Close()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("delivery still blocked after Close")
+	}
+	if n := d.Dropped(); n != 0 {
+		t.Errorf("got %d dropped fixes, want 0", n)
+	}
+}
+
+func TestQuietPeriod(t *testing.T) {
+	// The cycles never end with GPGSV: each one is flushed after 20 ms.
+	d := NewDecoder(Options{Lsdt: "GPGSV", QuietPeriod: 20 * time.Millisecond, BufSize: 1})
+	for s := 0; s < 2; s++ {
+		for _, ss := range cycle(s) {
+			d.Feed([]byte(ss))
+		}
+		select {
+		case li := <-d.Fixes():
+			if li.Smask != GxGGA|GxRMC|GxGSA || li.Utc.Second != uint16(s) {
+				t.Errorf("fix %d: got Smask %#x at %+v", s, li.Smask, li.Utc)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("cycle %d not flushed", s)
+		}
+	}
+	d.Close()
+}
+
+func TestFlush(t *testing.T) {
+	clk := &fakeClock{time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)}
+	d := NewDecoder(Options{Lsdt: "GPGSV", Clock: clk, QuietPeriod: -1, BufSize: 2})
+	feedCycle(d, clk, 0)
+	d.Flush()
+	d.Flush() // nothing pending
+	d.Close()
+	n := 0
+	for li := range d.Fixes() {
+		if li.Smask != GxGGA|GxRMC|GxGSA {
+			t.Errorf("got Smask %#x", li.Smask)
+		}
+		n++
+	}
+	if n != 1 {
+		t.Errorf("got %d fixes, want 1", n)
+	}
+}
+
+func TestCycle(t *testing.T) {
+	tests := []struct {
+		name  string
+		opts  Options
+		fixes int // after 3 cycles
+	}{
+		{"sentence", Options{Lsdt: "GPGSA"}, 3},
+		{"timestamp", Options{Cycle: LOC_CYCLE_TIMESTAMP}, 2}, // the last cycle is still pending
+		{"hybrid", Options{Lsdt: "GPGSA", Cycle: LOC_CYCLE_HYBRID}, 3},
+		{"hybrid, wrong lsdt", Options{Lsdt: "GPGSV", Cycle: LOC_CYCLE_HYBRID}, 2},
+		{"quiet period", Options{Lsdt: "GPGSV", QuietPeriod: 500 * time.Millisecond}, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t0 := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+			clk := &fakeClock{t0}
+			tt.opts.Clock, tt.opts.BufSize = clk, 10
+			if tt.opts.QuietPeriod == 0 {
+				tt.opts.QuietPeriod = -1
+			}
+			d := NewDecoder(tt.opts)
+			fixes := feedCycles(d, clk, 3)
+			if len(fixes) != tt.fixes {
+				t.Fatalf("got %d fixes, want %d", len(fixes), tt.fixes)
+			}
+			for i, li := range fixes {
+				if li.Smask != GxGGA|GxRMC|GxGSA || li.Utc.Second != uint16(i) {
+					t.Errorf("fix %d: got Smask %#x at %+v", i, li.Smask, li.Utc)
+				}
+				// Received from GGA to GSA, 20 ms later.
+				rx := t0.Add(time.Duration(i) * 1030 * time.Millisecond)
+				if !li.RxFirst.Equal(rx) || !li.RxLast.Equal(rx.Add(20*time.Millisecond)) {
+					t.Errorf("fix %d: got reception times %v - %v", i, li.RxFirst, li.RxLast)
+				}
+			}
+			if r := d.Rate(); r != 1 {
+				t.Errorf("got rate %v, want 1", r)
+			}
+		})
+	}
+}
+
+// Sentences without time that start a cycle belong to the epoch that
+// follows them, even after a quiet period.
+func TestCycleUntimedFirst(t *testing.T) {
+	for _, opts := range []Options{
+		{Cycle: LOC_CYCLE_TIMESTAMP},
+		{Cycle: LOC_CYCLE_HYBRID},
+		{Lsdt: "GPRMC", Cycle: LOC_CYCLE_HYBRID},
+	} {
+		clk := &fakeClock{time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)}
+		opts.Clock, opts.BufSize = clk, 10
+		d := NewDecoder(opts)
+		for s := 0; s < 3; s++ {
+			c := cycle(s)
+			for _, ss := range []string{c[2], c[0], c[1]} { // GSA, GGA, RMC
+				d.FeedAt([]byte(ss), clk.Now())
+				clk.t = clk.t.Add(10 * time.Millisecond)
+			}
+			clk.t = clk.t.Add(time.Second)
+		}
+		d.Flush()
+		d.Close()
+		n := 0
+		for li := range d.Fixes() {
+			if li.Smask&(GxGGA|GxRMC) != GxGGA|GxRMC || li.Utc.Second != uint16(n) {
+				t.Errorf("%+v: fix %d: got Smask %#x at %+v", opts, n, li.Smask, li.Utc)
+			}
+			n++
+		}
+		if n != 3 {
+			t.Errorf("%+v: got %d fixes, want 3", opts, n)
+		}
+	}
+}
@@ -5,11 +5,38 @@ At the end of each NMEA cycle, a new fix is compiled and a LocInfo
 structure is delivered on a channel. This channel is created on user's
 behalf when the Init function is called.
 
+Init, Feed and Exit operate on a default Decoder held by the package.
+Programs that have to decode several NMEA streams at the same time, e.g.
+a gateway connected to more than one GNSS receiver, should create one
+Decoder per stream with NewDecoder and retrieve the fixes of each stream
+with its Fixes method.
+
+A Decoder is also an io.Writer, and its Run method takes care of the
+whole read loop of an io.Reader such as a serial port, with the support
+of a context for cancellation.
+
+All the timing decisions of a Decoder rely on a Clock given in Options.
+Together with FeedAt, which feeds data received at a given time, this
+allows NMEA logs recorded with their capture timestamps to be replayed
+exactly, whatever the speed of the machine. The receive times of the first
+and last sentences of each fix are given by LocInfo.RxFirst and RxLast, e.g.
+to measure the latency of the serial link, while LocTime.Time converts the
+UTC time of the fix into a time.Time.
+
+Invalid sentences (bad checksum, missing fields and so on) are reported as
+*SentenceError values to the OnError handler given in Options. The package
+itself never prints anything.
+
 The LocInfo structure gives information about the quality of the fix
 (navigation mode, DOPs, etc.), time, actual location (latitude,
 longitude, elevation), speed, heading as well as the characteristics of
 the satellites in view and used for the solution.
 
+Whatever the sentences actually received, the Valid bitmask of a LocInfo
+tells which of its fields have been given, and its capabilities (HasTime,
+Has2D, Has3D, HasDOP, etc.) what it can be used for. The Level of a fix is
+derived from these capabilities.
+
 Example usage
 
 A typical usage would look like the following code.
@@ -123,11 +150,16 @@ messages only once in five. Finally, some manufacturers chose to send
 only one GPGSV per cycle, thereby creating a sort of 'super cycle' during
 which all GPGSVs are sent.
 
-The output of some old GPS receivers that issue a single GPGSV message per
-NMEA cycle is not handled very gracefully by this package. In this situation,
-the satellites are cleared when the first GPGSV sentence of a 'super cycle'
-is encoutered and only the cycle containing the last GPGSV sentence will give
-a fix with the actual number of satellites.
+GSV bursts are tracked independently for each talker (GPGSV, GLGSV,
+GAGSV...) and, with NMEA 4.11, for each signal. The satellites of a burst
+replace those of the previous one only when its last sentence is received,
+so that the fixes of a 'super cycle' give the satellites of the last complete
+burst. Each satellite is identified by its constellation and its PRN within
+this constellation, taken from the talker, the NMEA 4.11 system ID of GSA or,
+for GN sentences, the extended numbering (e.g. 65-96 for GLONASS).
+LocInfo.Systems sums up the satellites in view and in use, the signal
+strengths and the GSA DOPs of each constellation, while the DOPs of LocInfo
+are those of the combined solution (first GSA of the cycle).
 
 For illustration, here is the output of a Garmin GPS receiver made in 2005
 and its interpretation by loc:
@@ -139,7 +171,7 @@ and its interpretation by loc:
 	$PGRMM,WGS 84*06
 	
 	18:34:55: Lat = 41.412231, Lon = -81.870766, Quality = 2, Mode = 2, HDOP = 2.500000, Level = 5
-	          Sats (*1/4): 2 *4 5 6 
+	          Sats (*4/12): 2 *4 5 6 *7 *10 13 23 24 30 33 *35 
 	
 	$GPRMC,183456,A,4124.7342,N,08152.2464,W,000.0,000.0,010305,007.9,W*79
 	$GPGGA,183456,4124.7342,N,08152.2464,W,2,04,2.5,259.0,M,-34.0,M,,*72
@@ -149,7 +181,7 @@ and its interpretation by loc:
 	$PGRMM,WGS 84*06
 	
 	18:34:56: Lat = 41.412239, Lon = -81.870773, Quality = 2, Mode = 2, HDOP = 2.500000, Level = 5
-	          Sats (*3/8): 2 *4 5 6 *7 *10 13 23 
+	          Sats (*4/12): 2 *4 5 6 *7 *10 13 23 24 30 33 *35 
 	
 	$GPRMC,183457,A,4124.7342,N,08152.2464,W,000.0,000.0,010305,007.9,W*78
 	$GPGGA,183457,4124.7342,N,08152.2464,W,2,04,2.5,258.8,M,-34.0,M,,*7A
@@ -174,8 +206,3 @@ It is also based on work carried out at ACTIA PCs (http://www.actia-pcs.fr/en/)
 as part of the EBSF 2 project (http://ebsf2.eu/).
 */
 package loc
-
-/* BUG(rdeg): The output of some old GPS receivers that issue a single
-GPGSV sentence per NMEA cycle is not handled very gracefully.  See the
-Overview section for details.
-*/
\ No newline at end of file
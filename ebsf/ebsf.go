@@ -40,11 +40,35 @@ type EBSFLocInfo struct {
 	Speed   float32     // Speed over the ground in kilometers/hour
 	Heading float32     // Track angle in degrees True
 	Mv      float32     // Magnetic variation degrees (Easterly var. subtracts from true course)
-	Satinfo struct {    // Satellites information
-		Inuse  uint16               // Number of satellites in use (not those in view)
-		Inview uint16               // Total number of satellites in view
-		Sat [EBSF_MAXSAT]EBSFLocSat // Per-satellite information
-	}
+	Satinfo EBSFSatInfo // Satellites information
+}
+
+// Type EBSFSatInfo gives information about all visible satellites.
+type EBSFSatInfo struct {
+	Inuse  uint16               // Number of satellites in use (not those in view)
+	Inview uint16               // Total number of satellites in view
+	Sat [EBSF_MAXSAT]EBSFLocSat // Per-satellite information
+}
+
+// Type EBSFLocInfoHP is a high-precision variant of EBSFLocInfo, where the
+// latitude, longitude and altitude are given in double precision.
+// It is returned by PackHP in a []byte.
+type EBSFLocInfoHP struct {
+	Level   uint8       // Level of information available
+	Quality uint8       // GPS quality indicator (0 = Invalid; 1 = Fix; 2 = Differential, 3 = Sensitive)
+	NavMode uint8       // Operating mode, used for navigation (1 = Fix not available; 2 = 2D; 3 = 3D)
+	Smask   uint8       // NMEA sentences processed for this fix
+	Utc     loc.LocTime	// UTC of position
+	Pdop    float32     // Position Dilution Of Precision
+	Hdop    float32     // Horizontal Dilution Of Precision
+	Vdop    float32     // Vertical Dilution Of Precision
+	Lat     float64     // Latitude
+	Lon     float64     // Longitude
+	Elv     float64     // Antenna altitude above/below mean sea level (geoid) in meters
+	Speed   float32     // Speed over the ground in kilometers/hour
+	Heading float32     // Track angle in degrees True
+	Mv      float32     // Magnetic variation degrees (Easterly var. subtracts from true course)
+	Satinfo EBSFSatInfo // Satellites information
 }
 
 /*
@@ -100,9 +124,52 @@ func Pack(li *loc.LocInfo) []byte {
 	var eli EBSFLocInfo
 
 	eli.Level = li.Level
-	eli.Quality = li.Quality
+	eli.Quality = uint8(li.Quality)
 	eli.NavMode = li.NavMode
-	eli.Smask = li.Smask
+	eli.Smask = uint8(li.Smask) // ZDA and beyond do not fit
+	eli.Utc = li.Utc
+	eli.Pdop = li.Pdop
+	eli.Hdop = li.Hdop
+	eli.Vdop = li.Vdop
+	eli.Lat = float32(li.Lat)
+	eli.Lon = float32(li.Lon)
+	eli.Elv = float32(li.Elv)
+	eli.Speed = li.Speed
+	eli.Heading = li.Heading
+	eli.Mv = li.Mv
+	packSats(&eli.Satinfo, li.Sats)
+
+	binary.Write(&buf, binary.LittleEndian, eli)
+//fmt.Println("sizeof(eli) =", unsafe.Sizeof(eli), "len(buf.Bytes()) =", len(buf.Bytes()))
+//fmt.Println("outbuf =", buf.Bytes())
+	return buf.Bytes()
+}
+
+/*
+PackHP is like Pack but packs a loc.LocInfo structure into an EBSFLocInfoHP,
+where latitude, longitude and altitude keep their double precision.
+
+The layout is the one of the EBSF LOCINFO, except for the following fields:
+
+	    double         lat;       // 32: Latitude
+	    double         lon;       // 40: Longitude
+	    double         elv;       // 48: Antenna altitude above/below mean sea level (geoid) in meters
+	    float          speed      // 56: Speed over the ground in kilometers/hour
+	    float          heading;   // 60: Track angle in degrees True
+	    float          mv;        // 64: Magnetic variation degrees (Easterly var. subtracts from true course)
+	    struct { ... } satinfo;   // 68: Information about all visible satellites (260 bytes)
+	} LOCINFOHP;                  // 328 bytes (68 + 260)
+
+The result is returned in a slice of exactly 328 bytes.
+*/
+func PackHP(li *loc.LocInfo) []byte {
+	var buf bytes.Buffer
+	var eli EBSFLocInfoHP
+
+	eli.Level = li.Level
+	eli.Quality = uint8(li.Quality)
+	eli.NavMode = li.NavMode
+	eli.Smask = uint8(li.Smask) // ZDA and beyond do not fit
 	eli.Utc = li.Utc
 	eli.Pdop = li.Pdop
 	eli.Hdop = li.Hdop
@@ -113,7 +180,14 @@ func Pack(li *loc.LocInfo) []byte {
 	eli.Speed = li.Speed
 	eli.Heading = li.Heading
 	eli.Mv = li.Mv
+	packSats(&eli.Satinfo, li.Sats)
+
+	binary.Write(&buf, binary.LittleEndian, eli)
+	return buf.Bytes()
+}
 
+// Fill an EBSFSatInfo with the given satellites.
+func packSats(esi *EBSFSatInfo, sats []loc.LocSat) {
 	copySat := func(esat *EBSFLocSat, sat *loc.LocSat) {
 		esat.Id = uint16(sat.Id)
 		esat.Elv = sat.Elv
@@ -129,30 +203,24 @@ func Pack(li *loc.LocInfo) []byte {
 
 	// Copy in-use satellites first, then copy the other satellites.
 	// We cannot copy the info of more than EBSF_MAXSAT satellites.
-	eli.Satinfo.Inview = 0
-	for i := range li.Sats {
-		if li.Sats[i].Inuse {
-			copySat(&eli.Satinfo.Sat[eli.Satinfo.Inview], &li.Sats[i])
-			eli.Satinfo.Inuse++
-			eli.Satinfo.Inview++
-			if eli.Satinfo.Inview == EBSF_MAXSAT {
-				goto copydone
+	esi.Inview = 0
+	for i := range sats {
+		if sats[i].Inuse {
+			copySat(&esi.Sat[esi.Inview], &sats[i])
+			esi.Inuse++
+			esi.Inview++
+			if esi.Inview == EBSF_MAXSAT {
+				return
 			}
 		}
 	}
-	for i := range li.Sats {
-		if !li.Sats[i].Inuse {
-			copySat(&eli.Satinfo.Sat[eli.Satinfo.Inview], &li.Sats[i])
-			eli.Satinfo.Inview++
-			if eli.Satinfo.Inview == EBSF_MAXSAT {
-				goto copydone
+	for i := range sats {
+		if !sats[i].Inuse {
+			copySat(&esi.Sat[esi.Inview], &sats[i])
+			esi.Inview++
+			if esi.Inview == EBSF_MAXSAT {
+				return
 			}
 		}
 	}
-copydone:
-
-	binary.Write(&buf, binary.LittleEndian, eli)
-//fmt.Println("sizeof(eli) =", unsafe.Sizeof(eli), "len(buf.Bytes()) =", len(buf.Bytes()))
-//fmt.Println("outbuf =", buf.Bytes())
-	return buf.Bytes()
-}
\ No newline at end of file
+}
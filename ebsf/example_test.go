@@ -9,23 +9,37 @@ import (
 )
 
 func ExamplePack() {
+	done := make(chan struct {})
+	defer close(done)
+	work := loc.Init("", 0)
+	defer loc.Exit()
+	go packHandler(work, done)
+}
+
+// packHandler packs the fixes received on work until done is closed.
+func packHandler(work <-chan *loc.LocInfo, done <-chan struct{}) {
 	// This typically happens in the locHandler Goroutine.
-	select {
-	case li := <-work:
-		// Pack the loc.LocInfo we just received.
-		pli := ebsf.Pack(li)
-		
-		// loc.Pack returns a slice of bytes whose payload should
-		// exactly match an EBSFLocInfo structure.
-		eli := (*ebsf.EBSFLocInfo)(unsafe.Pointer(&pli[0]))
-		
-		// Roughly check the packed version of the LocInfo.
-		if eli.Utc != li.Utc || eli.Lat != li.Lat || eli.Lon != li.Lon ||
-				int(eli.Satinfo.Inview) != len(li.Sats) {
-			panic("PACKED STRUCTURE DOES'NT MATCH UNPACKED ONE!\n")
+	for {
+		select {
+		case li, ok := <-work:
+			if !ok {
+				return
+			}
+			// Pack the loc.LocInfo we just received.
+			pli := ebsf.Pack(li)
+			
+			// ebsf.Pack returns a slice of bytes whose payload should
+			// exactly match an EBSFLocInfo structure.
+			eli := (*ebsf.EBSFLocInfo)(unsafe.Pointer(&pli[0]))
+			
+			// Roughly check the packed version of the LocInfo.
+			if eli.Utc != li.Utc || eli.Lat != float32(li.Lat) || eli.Lon != float32(li.Lon) ||
+					int(eli.Satinfo.Inview) != len(li.Sats) {
+				panic("PACKED STRUCTURE DOES'NT MATCH UNPACKED ONE!\n")
+			}
+			log.Printf("Packed structure (%d bytes) is OK\n\n", len(pli))
+		case <-done:
+			return
 		}
-		log.Printf("Packed structure (%d bytes) is OK\n\n", len(pli))
-	case <-done:
-		return
 	}
 }
@@ -0,0 +1,50 @@
+package loc
+
+import (
+	"errors"
+	"strings"
+)
+
+// Errors reported by a Decoder.
+// They are wrapped in a SentenceError that gives the offending sentence.
+var (
+	ErrTooShort   = errors.New("sentence too short")
+	ErrTooLong    = errors.New("sentence too long")
+	ErrMissingCR  = errors.New("missing CR")
+	ErrChecksum   = errors.New("bad checksum")
+	ErrAddress    = errors.New("invalid address field")
+	ErrFieldCount = errors.New("not enough fields")
+	ErrInvalidGSV = errors.New("invalid GSV sentence")
+	ErrSatID      = errors.New("unexpected satellite number")
+)
+
+// A SentenceError records an error and the NMEA sentence that caused it.
+//
+// Use errors.Is to check the kind of error, e.g.
+// errors.Is(err, loc.ErrChecksum).
+type SentenceError struct {
+	Sentence string // offending sentence, without its trailing CR LF
+	Err      error  // one of the ErrXXX errors, possibly wrapped with details
+}
+
+func (e *SentenceError) Error() string {
+	return e.Sentence + ": " + e.Err.Error()
+}
+
+// Unwrap returns the underlying error.
+func (e *SentenceError) Unwrap() error {
+	return e.Err
+}
+
+// Report err, caused by sentence, to the error handler of the decoder.
+// Errors are silently ignored if no handler has been given.
+func (d *Decoder) report(sentence string, err error) {
+	if d.onError != nil {
+		d.onError(&SentenceError{Sentence: sentence, Err: err})
+	}
+}
+
+// Rebuild a sentence from its (spliced) fields, for error reporting.
+func joinS(fields []string) string {
+	return "$" + strings.Join(fields, ",")
+}
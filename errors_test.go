@@ -0,0 +1,54 @@
+package loc
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestErrors(t *testing.T) {
+	tests := []struct {
+		sentence string
+		err      error
+	}{
+		{"$GPGGA,1\r\n", ErrTooShort},
+		{nmea("GPGGA," + strings.Repeat("0", 80)), ErrTooLong},
+		{"$GPGGA,123519,4807.038,N\n", ErrMissingCR},
+		{"$GPGGA,123519,4807.038,N*00\r\n", ErrChecksum},
+		{nmea("GP,123519,4807.038,N"), ErrAddress},
+		{nmea("GPGGA,123519,4807.038,N"), ErrFieldCount},
+		{nmea("GPGSV,1,2,01,01,40,083,46"), ErrInvalidGSV},
+		{nmea("GPGSV,1,1,02,01,40,083,46"), ErrInvalidGSV},
+		{nmea("GPGSV,1,1,01,1000,40,083,46"), ErrSatID},
+		{nmea("GPGSA,A,3,04,-5,,,,,,,,,,,2.5,1.3,2.1"), ErrSatID},
+	}
+	for _, tt := range tests {
+		var errs []error
+		d := NewDecoder(Options{OnError: func(err error) { errs = append(errs, err) }})
+		d.Feed([]byte(tt.sentence))
+		if len(errs) != 1 || !errors.Is(errs[0], tt.err) {
+			t.Errorf("%q: got errors %v, want %v", tt.sentence, errs, tt.err)
+			continue
+		}
+		var se *SentenceError
+		if !errors.As(errs[0], &se) || !strings.HasPrefix(se.Sentence, "$GP") {
+			t.Errorf("%q: got %#v, want a *SentenceError", tt.sentence, errs[0])
+		}
+	}
+}
+
+// Malformed sentences are reported, or ignored, but never panic.
+func TestGarbage(t *testing.T) {
+	d := NewDecoder(Options{})
+	for _, body := range []string{
+		"GPGSV,1,1,x",
+		"GPGSV,1,1,01,01,40,083",
+		"GPGSA,A,3,1000,,,,,,,,,,,,,,",
+		"GPGGA,,,,,,,,,,,,,",
+		"GPRMC,,,,,,,,,,,,",
+		"GPRMC,123519,A,4807.038,N,01131.000,E,,,999999,,",
+		"GPRMC,xxxxxx,A,48xx.038,N,011xx.000,E,x,x,23xx94,x,W",
+	} {
+		d.Feed([]byte(nmea(body)))
+	}
+}
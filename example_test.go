@@ -1,9 +1,9 @@
 package loc_test
 
 import (
+	"io"
 	"log"
 	"os"
-	"unsafe"
 	
 	"github.com/rdeg/loc"
 )
@@ -48,23 +48,17 @@ func ExampleFeed() {
 		}
 	}
 }
-func ExamplePack() {
-	// This typically happens in the locHandler Goroutine.
-	select {
-	case li := <-work:
-		// Pack the LocInfo we just received.
-		pli := loc.Pack(li)
-		
-		// loc.Pack returns a slice of bytes whose payload should
-		// exactly match an EBSFLocInfo structure.
-		le := (*loc.EBSFLocInfo)(unsafe.Pointer(&pli[0]))
-		
-		// Roughly check the packed version of the LocInfo.
-		if le.Utc != li.Utc || le.Lat != li.Lat || le.Lon != li.Lon || int(le.Satinfo.Inview) != len(li.Sats) {
-			panic("PACKED STRUCTURE DOES'NT MATCH UNPACKED ONE!\n")
+// locHandler logs the fixes received on work until done is closed.
+func locHandler(work <-chan *loc.LocInfo, done <-chan struct{}) {
+	for {
+		select {
+		case li, ok := <-work:
+			if !ok {
+				return
+			}
+			log.Printf("LocInfo: %v\n\n", li)
+		case <-done:
+			return
 		}
-		log.Printf("Packed structure (%d bytes) is OK\n\n", len(pli))
-	case <-done:
-		return
 	}
 }
@@ -59,11 +59,11 @@ func locHandler(work chan *loc.LocInfo, done chan struct{}) {
 			switch {
 			case eli.Level != li.Level:
 				s = fmt.Sprintf("Level (%d != %d)", eli.Level, li.Level)
-			case eli.Quality != li.Quality:
+			case eli.Quality != uint8(li.Quality):
 				s = fmt.Sprintf("Quality (%d != %d)", eli.Quality, li.Quality)
 			case eli.NavMode != li.NavMode:
 				s = fmt.Sprintf("NavMode (%d != %d)", eli.NavMode, li.NavMode)
-			case eli.Smask != li.Smask:
+			case eli.Smask != uint8(li.Smask):
 				s = fmt.Sprintf("Smask (0x%02X != 0x%02X)", eli.Smask, li.Smask)
 			case eli.Utc != li.Utc:
 				s = fmt.Sprintf("Utc (%v != %v)", eli.Utc, li.Utc)
@@ -73,11 +73,11 @@ func locHandler(work chan *loc.LocInfo, done chan struct{}) {
 				s = fmt.Sprintf("Hdop (%f != %f)", eli.Hdop, li.Hdop)
 			case eli.Vdop != li.Vdop:
 				s = fmt.Sprintf("Level (%f != %f)", eli.Vdop, li.Vdop)
-			case eli.Lat != li.Lat:
+			case eli.Lat != float32(li.Lat):
 				s = fmt.Sprintf("Lat (%f != %f)", eli.Lat, li.Lat)
-			case eli.Lon != li.Lon:
+			case eli.Lon != float32(li.Lon):
 				s = fmt.Sprintf("Lon (%f != %f)", eli.Lon, li.Lon)
-			case eli.Elv != li.Elv:
+			case eli.Elv != float32(li.Elv):
 				s = fmt.Sprintf("Elv (%f != %f)", eli.Elv, li.Elv)
 			case eli.Speed != li.Speed:
 				s = fmt.Sprintf("Speed (%f != %f)", eli.Speed, li.Speed)
@@ -225,11 +225,13 @@ func main() {
 	var olsdt, lsdt string
 	var operiod, period int
 	var ominDel, minDel int
+	var cycle int
 	
 	// Retrieve command-line flags.
 	flag.IntVar(&ominDel, "minDel", -1, "specify the minimum delay between 2 NMEA cycles, in milliseconds")
 	flag.IntVar(&operiod, "period", -1, "specify the NMEA cycle period, in milliseconds")
 	flag.StringVar(&olsdt, "lsdt", "", "give the data type of the last sequence in the cycle (e.g. 'GPRMC')")
+	flag.IntVar(&cycle, "cycle", loc.LOC_CYCLE_SENTENCE, "cycle boundary detection (0: sentence type, 1: timestamp, 2: hybrid)")
 	flag.Parse()
 
 	// We expect as the first argument the name of a file containing an NMEA log.
@@ -272,7 +274,7 @@ fmt.Printf("lsdt = %s, minDel = %d, period = %d\n", lsdt, minDel, period)
 	// The channel used to retrieve fixes is returned by loc.Init.
 	done := make(chan struct {})
 	defer close(done)
-	work := loc.Init(lsdt, uint(minDel))
+	work := loc.InitOptions(loc.Options{Lsdt: lsdt, MinDelay: uint(minDel), Cycle: cycle})
 	defer loc.Exit()
 	go locHandler(work, done)
 
@@ -3,21 +3,19 @@
 package main
 
 import (
-	"io"
+	"context"
 	"log"
 	"os"
+	"os/signal"
 	
 	"github.com/rdeg/loc"
 )
 
 func main() {
-	// Start a go routine to handle GNSS fixes from the loc package.
-	done := make(chan struct {})	// channel used to terminate locHandler
-	defer close(done)
-	work := loc.Init("", 0)			// let loc package determine lsdt
-	defer loc.Exit()
-	go locHandler(work, done)
-	
+	// Stop decoding on Ctrl-C.
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+
 	// Open the GNSS device.
 	// Please note that some serial line tuning may be needed before
 	// operating the port, such as suppressing the echo and the conversion
@@ -27,33 +25,21 @@ func main() {
 		log.Fatal(err)
 	}
 	defer file.Close()
+	go func() {
+		<-ctx.Done()
+		file.Close()	// unblock the pending read
+	}()
 
-	// Read the GNSS device stream and feed-back the loc package.
-	buf := make([]byte, 1024)
-	for {
-		n, err := file.Read(buf)
-		if n > 0 {
-//log.Println(string(buf[:n]))
-			loc.Feed(buf[:n])
-		}
-		if err == io.EOF {
-			break
-		}
-		if err != nil {
-			log.Printf("Error: read %d bytes: %v\n", n, err)
-			break
-		}
+	// Read the GNSS device stream and decode it until EOF, error or Ctrl-C.
+	d := loc.NewDecoder(loc.Options{	// let loc package determine lsdt
+		OnError: func(err error) { log.Println(err) },
+	})
+	errc := d.Run(ctx, file)
+	for li := range d.Fixes() {
+		log.Printf("LocInfo: %v\n\n", li)
 	}
-}
-
-// This goroutine handles the LocData sent by the loc package.
-func locHandler(work chan *loc.LocInfo, done chan struct{}) {
-	for {
-		select {
-			case li := <-work:
-			log.Printf("LocInfo: %v\n\n", li)
-		case <-done:
-			return	// exit the handler
-		}
+	if err := <-errc; err != nil {
+		log.Printf("Error: %v\n", err)
 	}
+	log.Printf("%d fixes dropped, %.1f Hz\n", d.Dropped(), d.Rate())
 }
@@ -0,0 +1,97 @@
+package loc
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Garmin proprietary information, given by the PGRME, PGRMM, PGRMZ and
+// PGRMT sentences.
+//
+// The fields are only meaningful when the matching sentence has been
+// received during the cycle (see the PGRMx bits of LocInfo.Smask and the
+// LOC_VALID_XXX bits of LocInfo.Valid).
+type LocGarmin struct {
+	Ehpe   float32 // Estimated horizontal position error in meters (PGRME)
+	Evpe   float32 // Estimated vertical position error in meters (PGRME)
+	Epe    float32 // Overall spherical equivalent position error in meters (PGRME)
+	Datum  string  // Map datum name, e.g. "WGS 84" (PGRMM)
+	Alt    float64 // Altitude in meters (PGRMZ, converted from feet)
+	AltDim uint8   // Position fix dimensions (PGRMZ: 2 = user altitude, 3 = GPS altitude)
+
+	// Sensor status information (PGRMT).
+	Firmware        string  // Product, model and software version (e.g. "GPS 15L/15H VER 2.05")
+	RomFail         bool    // ROM checksum test failed
+	ReceiverFail    bool    // Receiver failure discrete
+	StoredDataLost  bool    // Stored data lost
+	ClockLost       bool    // Real time clock lost
+	OscillatorDrift bool    // Oscillator drift discrete
+	Collecting      bool    // Data collection discrete
+	Temperature     float32 // GPS sensor temperature in degrees C
+	ConfigLost      bool    // GPS sensor configuration data lost
+}
+
+// PGRME: Garmin estimated error information
+func (d *Decoder) doPGRME(fields []string) {
+	if e, ok := parseF(fields, 1); ok && fields[2] == "M" { // EHPE
+		d.curLoc.Garmin.Ehpe = float32(e)
+		d.curLoc.Valid |= LOC_VALID_EHPE
+	}
+	if e, ok := parseF(fields, 3); ok && fields[4] == "M" { // EVPE
+		d.curLoc.Garmin.Evpe = float32(e)
+		d.curLoc.Valid |= LOC_VALID_EVPE
+	}
+	if e, ok := parseF(fields, 5); ok && fields[6] == "M" { // EPE
+		d.curLoc.Garmin.Epe = float32(e)
+		d.curLoc.Valid |= LOC_VALID_EPE
+	}
+
+	d.curLoc.Smask |= PGRME
+}
+
+// PGRMM: Garmin map datum
+func (d *Decoder) doPGRMM(fields []string) {
+	d.curLoc.Garmin.Datum = strings.TrimSpace(fields[1])
+
+	d.curLoc.Smask |= PGRMM
+}
+
+// PGRMZ: Garmin altitude
+func (d *Decoder) doPGRMZ(fields []string) {
+	if a, ok := parseF(fields, 1); ok && fields[2] == "f" { // altitude (feet)
+		d.curLoc.Garmin.Alt = a * 0.3048 // m
+		if len(fields) > 3 {
+			dim, _ := strconv.Atoi(fields[3])
+			d.curLoc.Garmin.AltDim = uint8(dim)
+		}
+		d.curLoc.Valid |= LOC_VALID_GARMIN_ALT
+	}
+
+	d.curLoc.Smask |= PGRMZ
+}
+
+// PGRMT: Garmin sensor status information
+// Missing fields are assumed to report no failure.
+func (d *Decoder) doPGRMT(fields []string) {
+	field := func(i int) string {
+		if i < len(fields) {
+			return fields[i]
+		}
+		return ""
+	}
+
+	g := &d.curLoc.Garmin
+	g.Firmware = strings.TrimSpace(fields[1])
+	g.RomFail = field(2) == "F"
+	g.ReceiverFail = field(3) == "F"
+	g.StoredDataLost = field(4) == "L"
+	g.ClockLost = field(5) == "L"
+	g.OscillatorDrift = field(6) == "F"
+	g.Collecting = field(7) == "C"
+	if t, ok := parseF(fields, 8); ok {
+		g.Temperature = float32(t)
+	}
+	g.ConfigLost = field(9) == "L"
+
+	d.curLoc.Smask |= PGRMT
+}
@@ -0,0 +1,29 @@
+package loc
+
+import "testing"
+
+func TestGarmin(t *testing.T) {
+	li := decode(t,
+		"PGRME,15.0,M,45.0,M,25.0,M",
+		"PGRMM,WGS 84",
+		"PGRMZ,246,f,3",
+		"PGRMT,GPS 15L/15H VER 2.05,P,P,R,R,P,C,32,R",
+	)
+	g := li.Garmin
+	if g.Ehpe != 15 || g.Evpe != 45 || g.Epe != 25 || li.HorizontalAccuracy != 15 || li.VerticalAccuracy != 45 {
+		t.Errorf("PGRME: got %+v", g)
+	}
+	if g.Datum != "WGS 84" {
+		t.Errorf("PGRMM: got datum %q", g.Datum)
+	}
+	if !near(g.Alt, 74.9808) || g.AltDim != 3 {
+		t.Errorf("PGRMZ: got %v m (%dD)", g.Alt, g.AltDim)
+	}
+	if g.Firmware != "GPS 15L/15H VER 2.05" || g.RomFail || g.ReceiverFail || g.StoredDataLost || g.ClockLost ||
+		g.OscillatorDrift || !g.Collecting || g.Temperature != 32 || g.ConfigLost {
+		t.Errorf("PGRMT: got %+v", g)
+	}
+	if want := uint32(PGRME | PGRMM | PGRMZ | PGRMT); li.Smask != want {
+		t.Errorf("got Smask %#x, want %#x", li.Smask, want)
+	}
+}
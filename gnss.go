@@ -0,0 +1,195 @@
+package loc
+
+import (
+	"math/bits"
+	"strconv"
+)
+
+// Constellation identifies a satellite navigation system (see the
+// LOC_GNSS_XXX constants). The values 1 to 6 are the NMEA 4.11 system IDs.
+type Constellation uint8
+
+const (
+	LOC_GNSS_UNKNOWN Constellation = 0 // not known
+	LOC_GNSS_GPS     Constellation = 1 // GPS (USA)
+	LOC_GNSS_GLONASS Constellation = 2 // GLONASS (Russia)
+	LOC_GNSS_GALILEO Constellation = 3 // Galileo (Europe)
+	LOC_GNSS_BEIDOU  Constellation = 4 // BeiDou (China)
+	LOC_GNSS_QZSS    Constellation = 5 // QZSS (Japan)
+	LOC_GNSS_NAVIC   Constellation = 6 // NavIC / IRNSS (India)
+	LOC_GNSS_SBAS    Constellation = 7 // SBAS (WAAS, EGNOS, MSAS...), reported with the GPS system ID
+)
+
+var constellationNames = [...]string{
+	LOC_GNSS_UNKNOWN: "unknown",
+	LOC_GNSS_GPS:     "GPS",
+	LOC_GNSS_GLONASS: "GLONASS",
+	LOC_GNSS_GALILEO: "Galileo",
+	LOC_GNSS_BEIDOU:  "BeiDou",
+	LOC_GNSS_QZSS:    "QZSS",
+	LOC_GNSS_NAVIC:   "NavIC",
+	LOC_GNSS_SBAS:    "SBAS",
+}
+
+func (c Constellation) String() string {
+	if int(c) < len(constellationNames) {
+		return constellationNames[c]
+	}
+	return "Constellation(" + strconv.Itoa(int(c)) + ")"
+}
+
+// Constellation of the sentences given by each talker.
+// GN (combined) sentences are not listed, the satellite numbers or the
+// NMEA 4.11 system ID have to be used instead.
+var talkerGNSS = map[string]Constellation{
+	"GP": LOC_GNSS_GPS,
+	"GL": LOC_GNSS_GLONASS,
+	"GA": LOC_GNSS_GALILEO,
+	"GB": LOC_GNSS_BEIDOU,
+	"BD": LOC_GNSS_BEIDOU,
+	"GQ": LOC_GNSS_QZSS,
+	"QZ": LOC_GNSS_QZSS,
+	"GI": LOC_GNSS_NAVIC,
+}
+
+// Return the constellation and the PRN within this constellation (slot
+// number for GLONASS) of satellite id, as numbered in a sentence for
+// constellation c (LOC_GNSS_UNKNOWN for GN sentences without system ID).
+// Both the NMEA 4.11 numbering and the extended numbering used before
+// (e.g. 65-96 for GLONASS or 301-336 for Galileo) are accepted.
+func satPrn(c Constellation, id int) (Constellation, uint16) {
+	switch c {
+	case LOC_GNSS_UNKNOWN: // extended numbering
+		switch {
+		case id >= 1 && id <= 32:
+			return LOC_GNSS_GPS, uint16(id)
+		case id >= 33 && id <= 64:
+			return LOC_GNSS_SBAS, uint16(id + 87)
+		case id >= 65 && id <= 96:
+			return LOC_GNSS_GLONASS, uint16(id - 64)
+		case id >= 120 && id <= 158:
+			return LOC_GNSS_SBAS, uint16(id)
+		case id >= 193 && id <= 200:
+			return LOC_GNSS_QZSS, uint16(id - 192)
+		case id >= 201 && id <= 263:
+			return LOC_GNSS_BEIDOU, uint16(id - 200)
+		case id >= 301 && id <= 336:
+			return LOC_GNSS_GALILEO, uint16(id - 300)
+		case id >= 401 && id <= 463:
+			return LOC_GNSS_BEIDOU, uint16(id - 400)
+		}
+	case LOC_GNSS_GPS: // SBAS and QZSS may be reported as GPS
+		switch {
+		case id >= 33 && id <= 64:
+			return LOC_GNSS_SBAS, uint16(id + 87)
+		case id >= 120 && id <= 158:
+			return LOC_GNSS_SBAS, uint16(id)
+		case id >= 193 && id <= 202:
+			return LOC_GNSS_QZSS, uint16(id - 192)
+		}
+	case LOC_GNSS_GLONASS:
+		if id >= 65 && id <= 96 {
+			return c, uint16(id - 64)
+		}
+	case LOC_GNSS_GALILEO:
+		if id >= 301 && id <= 336 {
+			return c, uint16(id - 300)
+		}
+	case LOC_GNSS_BEIDOU:
+		switch {
+		case id >= 201 && id <= 263:
+			return c, uint16(id - 200)
+		case id >= 401 && id <= 463:
+			return c, uint16(id - 400)
+		}
+	case LOC_GNSS_QZSS:
+		if id >= 193 && id <= 202 {
+			return c, uint16(id - 192)
+		}
+	}
+	return c, uint16(id)
+}
+
+// NMEA 4.11 signal names, indexed by signal ID, for each constellation.
+var signalNames = map[Constellation][]string{
+	LOC_GNSS_GPS:     {1: "L1 C/A", 2: "L1 P(Y)", 3: "L1 M", 4: "L2 P(Y)", 5: "L2C-M", 6: "L2C-L", 7: "L5-I", 8: "L5-Q"},
+	LOC_GNSS_GLONASS: {1: "G1 C/A", 2: "G1 P", 3: "G2 C/A", 4: "G2 P"},
+	LOC_GNSS_GALILEO: {1: "E5a", 2: "E5b", 3: "E5 a+b", 4: "E6-A", 5: "E6-BC", 6: "L1-A", 7: "L1-BC"},
+	LOC_GNSS_BEIDOU:  {1: "B1I", 2: "B1Q", 3: "B1C", 4: "B1A", 5: "B2-a", 6: "B2-b", 7: "B2 a+b", 8: "B3I", 9: "B3Q", 10: "B3A", 11: "B2I", 12: "B2Q"},
+	LOC_GNSS_QZSS:    {1: "L1 C/A", 2: "L1C (D)", 3: "L1C (P)", 4: "LIS", 5: "L2C-M", 6: "L2C-L", 7: "L5-I", 8: "L5-Q", 10: "L6D", 11: "L6E"},
+	LOC_GNSS_NAVIC:   {1: "L5-SPS", 2: "S-SPS", 3: "L5-RS", 4: "S-RS", 5: "L1-SPS"},
+	LOC_GNSS_SBAS:    {1: "L1 C/A", 7: "L5-I", 8: "L5-Q"},
+}
+
+// SignalName returns the name of the signal the satellite information is
+// about (e.g. "L1 C/A" or "E5a"), or "" if the signal is not known.
+func (s LocSat) SignalName() string {
+	if names := signalNames[s.Constellation]; int(s.Signal) < len(names) {
+		return names[s.Signal]
+	}
+	return ""
+}
+
+// Summary of the contribution of a constellation to a fix.
+type LocSystem struct {
+	Constellation Constellation // GNSS (see the LOC_GNSS_XXX constants)
+	InView        uint8         // Satellites in view
+	InUse         uint8         // Satellites used for the fix
+	MeanCno       float32       // Mean signal strength (C/N0) of the satellites received, in dBHz
+	MaxCno        uint8         // Highest signal strength (C/N0), in dBHz
+
+	HasDOP bool    // The DOPs below have been given by a GSA for this constellation
+	Pdop   float32 // Position Dilution Of Precision
+	Hdop   float32 // Horizontal Dilution Of Precision
+	Vdop   float32 // Vertical Dilution Of Precision
+}
+
+// Build the per constellation summary of the current fix.
+// Satellites tracked on several signals are only counted once; the in-use
+// satellites are those of the GSA sentences of the cycle, if any.
+func (d *Decoder) systems() []LocSystem {
+	sys := d.sys
+	var seen [LOC_GNSS_SBAS + 1]map[uint16]bool
+	var cno [LOC_GNSS_SBAS + 1]struct{ sum, n int }
+	for _, s := range d.curLoc.Sats {
+		c := s.Constellation
+		if int(c) >= len(sys) {
+			continue
+		}
+		if s.Sig != 0 {
+			cno[c].sum += int(s.Sig)
+			cno[c].n++
+			if s.Sig > sys[c].MaxCno {
+				sys[c].MaxCno = s.Sig
+			}
+		}
+		if seen[c] == nil {
+			seen[c] = make(map[uint16]bool)
+		}
+		if seen[c][s.Prn] {
+			continue
+		}
+		seen[c][s.Prn] = true
+		sys[c].InView++
+		if s.Inuse && d.curLoc.Smask&GxGSA == 0 {
+			sys[c].InUse++
+		}
+	}
+
+	var ls []LocSystem
+	for c := range sys {
+		if d.curLoc.Smask&GxGSA != 0 {
+			for _, b := range d.iuBM[c] {
+				sys[c].InUse += uint8(bits.OnesCount8(b))
+			}
+		}
+		if cno[c].n != 0 {
+			sys[c].MeanCno = float32(cno[c].sum) / float32(cno[c].n)
+		}
+		if sys[c].InView != 0 || sys[c].InUse != 0 || sys[c].HasDOP {
+			sys[c].Constellation = Constellation(c)
+			ls = append(ls, sys[c])
+		}
+	}
+	return ls
+}
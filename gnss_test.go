@@ -0,0 +1,131 @@
+package loc
+
+import "testing"
+
+func TestSatPrn(t *testing.T) {
+	tests := []struct {
+		c    Constellation
+		id   int
+		wc   Constellation
+		wprn uint16
+	}{
+		{LOC_GNSS_UNKNOWN, 1, LOC_GNSS_GPS, 1},
+		{LOC_GNSS_UNKNOWN, 33, LOC_GNSS_SBAS, 120},
+		{LOC_GNSS_UNKNOWN, 65, LOC_GNSS_GLONASS, 1},
+		{LOC_GNSS_UNKNOWN, 96, LOC_GNSS_GLONASS, 32},
+		{LOC_GNSS_UNKNOWN, 120, LOC_GNSS_SBAS, 120},
+		{LOC_GNSS_UNKNOWN, 193, LOC_GNSS_QZSS, 1},
+		{LOC_GNSS_UNKNOWN, 201, LOC_GNSS_BEIDOU, 1},
+		{LOC_GNSS_UNKNOWN, 301, LOC_GNSS_GALILEO, 1},
+		{LOC_GNSS_UNKNOWN, 401, LOC_GNSS_BEIDOU, 1},
+		{LOC_GNSS_UNKNOWN, 500, LOC_GNSS_UNKNOWN, 500},
+		{LOC_GNSS_GPS, 5, LOC_GNSS_GPS, 5},
+		{LOC_GNSS_GPS, 35, LOC_GNSS_SBAS, 122},
+		{LOC_GNSS_GPS, 194, LOC_GNSS_QZSS, 2},
+		{LOC_GNSS_GLONASS, 70, LOC_GNSS_GLONASS, 6},
+		{LOC_GNSS_GLONASS, 6, LOC_GNSS_GLONASS, 6},
+		{LOC_GNSS_GALILEO, 305, LOC_GNSS_GALILEO, 5},
+		{LOC_GNSS_GALILEO, 5, LOC_GNSS_GALILEO, 5},
+		{LOC_GNSS_BEIDOU, 205, LOC_GNSS_BEIDOU, 5},
+		{LOC_GNSS_BEIDOU, 405, LOC_GNSS_BEIDOU, 5},
+		{LOC_GNSS_QZSS, 193, LOC_GNSS_QZSS, 1},
+		{LOC_GNSS_NAVIC, 3, LOC_GNSS_NAVIC, 3},
+	}
+	for _, tt := range tests {
+		if c, prn := satPrn(tt.c, tt.id); c != tt.wc || prn != tt.wprn {
+			t.Errorf("satPrn(%v, %d) = %v, %d; want %v, %d", tt.c, tt.id, c, prn, tt.wc, tt.wprn)
+		}
+	}
+}
+
+func TestSignalName(t *testing.T) {
+	tests := []struct {
+		s    LocSat
+		want string
+	}{
+		{LocSat{Constellation: LOC_GNSS_GPS, Signal: 1}, "L1 C/A"},
+		{LocSat{Constellation: LOC_GNSS_GALILEO, Signal: 7}, "L1-BC"},
+		{LocSat{Constellation: LOC_GNSS_GPS}, ""},
+		{LocSat{Constellation: LOC_GNSS_GLONASS, Signal: 9}, ""},
+		{LocSat{Constellation: LOC_GNSS_UNKNOWN, Signal: 1}, ""},
+	}
+	for _, tt := range tests {
+		if got := tt.s.SignalName(); got != tt.want {
+			t.Errorf("SignalName(%v, %d) = %q, want %q", tt.s.Constellation, tt.s.Signal, got, tt.want)
+		}
+	}
+}
+
+// Find the summary of constellation c.
+func system(li *LocInfo, c Constellation) *LocSystem {
+	for i := range li.Systems {
+		if li.Systems[i].Constellation == c {
+			return &li.Systems[i]
+		}
+	}
+	return nil
+}
+
+func TestSystems(t *testing.T) {
+	// NMEA 4.11: one GSA and one GSV burst per constellation and signal.
+	li := decode(t,
+		"GPGSV,1,1,02,05,40,083,46,12,20,280,38,1",
+		"GLGSV,1,1,01,70,50,120,40,1",
+		"GNGSA,A,3,05,12,,,,,,,,,,,1.5,0.9,1.2,1",
+		"GNGSA,A,3,70,,,,,,,,,,,,2.5,1.9,2.2,2",
+	)
+	if len(li.Sats) != 3 {
+		t.Fatalf("got %d satellites, want 3", len(li.Sats))
+	}
+	for _, s := range li.Sats {
+		if !s.Inuse {
+			t.Errorf("satellite %d not in use", s.Id)
+		}
+	}
+	if s := li.Sats[2]; s.Constellation != LOC_GNSS_GLONASS || s.Prn != 6 || s.SignalName() != "G1 C/A" {
+		t.Errorf("unexpected GLONASS satellite %+v", s)
+	}
+	gps, glo := system(li, LOC_GNSS_GPS), system(li, LOC_GNSS_GLONASS)
+	if gps == nil || gps.InView != 2 || gps.InUse != 2 || gps.MaxCno != 46 || gps.MeanCno != 42 || !gps.HasDOP || gps.Pdop != 1.5 {
+		t.Errorf("unexpected GPS summary %+v", gps)
+	}
+	if glo == nil || glo.InView != 1 || glo.InUse != 1 || !glo.HasDOP || glo.Hdop != 1.9 {
+		t.Errorf("unexpected GLONASS summary %+v", glo)
+	}
+	if li.Pdop != 1.5 || li.Hdop != 0.9 { // combined solution (first GSA)
+		t.Errorf("got DOPs %v/%v, want 1.5/0.9", li.Pdop, li.Hdop)
+	}
+
+	// NMEA 4.0: GNGSA without system ID, with mixed constellations.
+	li = decode(t, "GNGSA,A,3,01,70,,,,,,,,,,,1.8,1.0,1.5")
+	gps, glo = system(li, LOC_GNSS_GPS), system(li, LOC_GNSS_GLONASS)
+	if gps == nil || gps.InUse != 1 || !gps.HasDOP || glo == nil || glo.InUse != 1 || glo.HasDOP {
+		t.Errorf("unexpected summaries %+v", li.Systems)
+	}
+
+	// Invalid DOPs are not recorded.
+	li = decode(t, "GPGSA,A,3,01,,,,,,,,,,,,,1.0,x,1")
+	if gps = system(li, LOC_GNSS_GPS); gps == nil || gps.HasDOP {
+		t.Errorf("unexpected GPS summary %+v", gps)
+	}
+}
+
+// The satellites in use are those of the GSA sentences of each cycle, even
+// when GSV is not sent on every cycle.
+func TestInuse(t *testing.T) {
+	d := NewDecoder(Options{Lsdt: "GPGSA", QuietPeriod: -1, BufSize: 2})
+	for _, b := range []string{
+		"GPGSV,1,1,02,01,40,083,46,02,20,280,38",
+		"GPGSA,A,3,01,,,,,,,,,,,,2.5,1.3,2.1",
+		"GPGSA,A,3,02,,,,,,,,,,,,2.5,1.3,2.1",
+	} {
+		d.Feed([]byte(nmea(b)))
+	}
+	li1, li2 := <-d.Fixes(), <-d.Fixes()
+	if len(li1.Sats) != 2 || !li1.Sats[0].Inuse || li1.Sats[1].Inuse {
+		t.Errorf("first fix: got satellites %+v", li1.Sats)
+	}
+	if len(li2.Sats) != 2 || li2.Sats[0].Inuse || !li2.Sats[1].Inuse {
+		t.Errorf("second fix: got satellites %+v", li2.Sats)
+	}
+}
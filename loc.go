@@ -5,23 +5,58 @@ import (
 	"math"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
 const (
 	// Level of information available in the LocInfo structure (level)
+	// The level is derived from the capabilities of the fix (Caps).
 	LOC_HAVE_NOTHING    = 0 // nothing yet
-	LOC_HAVE_TIME       = 1 // UTC time, after RMC showing valid time and date fields
-	LOC_HAVE_POSITION   = 2 // + lat, lon, speed, direction, declination (nice RMC)
-	LOC_HAVE_ALTITUDE   = 3 // + elv (nice GGA)
-	LOC_HAVE_DOP        = 4 // + DOPs and active satellites (nice GSA)
-	LOC_HAVE_SATELLITES = 5 // + sats (after GSV)
+	LOC_HAVE_TIME       = 1 // UTC time and date (LOC_CAP_TIME and LOC_CAP_DATE)
+	LOC_HAVE_POSITION   = 2 // lat, lon of an actual fix (LOC_CAP_2D), time and date being optional
+	LOC_HAVE_ALTITUDE   = 3 // + elv (LOC_CAP_3D)
+	LOC_HAVE_DOP        = 4 // + DOPs (LOC_CAP_DOP)
+	LOC_HAVE_SATELLITES = 5 // + sats (LOC_CAP_SATELLITES)
+
+	// Capabilities of a fix (LocInfo.Caps), independent from each other
+	LOC_CAP_TIME       = 0x01 // UTC time
+	LOC_CAP_DATE       = 0x02 // UTC date
+	LOC_CAP_2D         = 0x04 // latitude and longitude of an actual fix (see FixQuality.IsFix)
+	LOC_CAP_3D         = 0x08 // same, with altitude
+	LOC_CAP_DOP        = 0x10 // horizontal and vertical DOPs
+	LOC_CAP_SATELLITES = 0x20 // satellites in view
+	LOC_CAP_ACCURACY   = 0x40 // horizontal accuracy estimate
+	LOC_CAP_VELOCITY   = 0x80 // speed and heading
 
 	// Fix quality indicator (quality, from GGA.Quality)
-	LOC_SIG_BAD  = 0 // no fix/invalid
-	LOC_SIG_GPS  = 1 // standard GPS (2D/3D)
-	LOC_SIG_DGPS = 2 // differential GPS
-	LOC_SIG_DR   = 6 // dead reckonning
+	LOC_SIG_BAD    FixQuality = 0 // no fix/invalid
+	LOC_SIG_GPS    FixQuality = 1 // standard GPS (2D/3D)
+	LOC_SIG_DGPS   FixQuality = 2 // differential GPS
+	LOC_SIG_PPS    FixQuality = 3 // PPS fix
+	LOC_SIG_RTK    FixQuality = 4 // real time kinematic, fixed integers
+	LOC_SIG_FRTK   FixQuality = 5 // real time kinematic, float integers
+	LOC_SIG_DR     FixQuality = 6 // dead reckonning
+	LOC_SIG_MANUAL FixQuality = 7 // manual input mode
+	LOC_SIG_SIM    FixQuality = 8 // simulator mode
+
+	// Positioning mode indicator (Mode, from RMC, GLL, VTG or GNS, NMEA 2.3+)
+	LOC_MODE_AUTONOMOUS   = 'A' // autonomous
+	LOC_MODE_DIFFERENTIAL = 'D' // differential
+	LOC_MODE_ESTIMATED    = 'E' // estimated (dead reckoning)
+	LOC_MODE_FLOAT_RTK    = 'F' // RTK float
+	LOC_MODE_MANUAL       = 'M' // manual input
+	LOC_MODE_NONE         = 'N' // data not valid
+	LOC_MODE_PRECISE      = 'P' // precise
+	LOC_MODE_RTK          = 'R' // RTK fixed
+	LOC_MODE_SIMULATOR    = 'S' // simulator
+
+	// Navigational status indicator (NavStatus, from RMC, NMEA 4.1+)
+	LOC_NAV_SAFE     = 'S' // safe
+	LOC_NAV_CAUTION  = 'C' // caution
+	LOC_NAV_UNSAFE   = 'U' // unsafe
+	LOC_NAV_NOTVALID = 'V' // navigational status not valid (i.e. not provided by the receiver)
 
 	// Navigation mode (navMode, from GSA.NavMode)
 	LOC_FIX_NONE = 0 // no position fix
@@ -36,12 +71,102 @@ const (
 	GxRMC = 0x0004 // RMC - Recommended Minimum Specific GPS/TRANSIT Data.
 	GxVTG = 0x0008 // VTG - Actual track made good and speed over ground.
 	GxGSV = 0x0010 // GSV - Number of satellites in view, PRN numbers, elevation, azimuth & SNR values.
-	GLGSV = 0x0020 // like GPGSV but for Glonass satellites
-	GAGSV = 0x0040 // like GPGSV but for Galileo satellites
+	GLGSV = 0x0020 // like GPGSV but for Glonass satellites (GxGSV is also set)
+	GAGSV = 0x0040 // like GPGSV but for Galileo satellites (GxGSV is also set)
+	GxGLL = 0x0080 // GLL - Geographic position, latitude / longitude.
+	GxZDA = 0x0100 // ZDA - Time and date, with local time zone.
+	GxGNS = 0x0200 // GNS - Multi-constellation fix data.
+	GxGST = 0x0400 // GST - Pseudorange error statistics.
+	PGRME = 0x0800 // PGRME - Garmin estimated error information.
+	PGRMM = 0x1000 // PGRMM - Garmin map datum.
+	PGRMZ = 0x2000 // PGRMZ - Garmin altitude.
+	PGRMT = 0x4000 // PGRMT - Garmin sensor status information.
+	PUBX00 = 0x00008000 // PUBX,00 - u-blox position.
+	PUBX03 = 0x00010000 // PUBX,03 - u-blox satellite status.
+	PUBX04 = 0x00020000 // PUBX,04 - u-blox time of day and clock information.
 
 	GSA_MAXSAT = 12 // max sats in a GSA message
+
+	// Validity of the optional fields of the LocInfo structure (Valid)
+	LOC_VALID_NUMUSED     = 0x00000001 // NumUsed (from GGA)
+	LOC_VALID_GEOIDSEP    = 0x00000002 // GeoidSep (from GGA)
+	LOC_VALID_ELLIPSOIDAL = 0x00000004 // EllipsoidalHeight (altitude and geoid separation in GGA)
+	LOC_VALID_DIFFAGE     = 0x00000008 // DiffAge (from GGA)
+	LOC_VALID_DIFFSTATION = 0x00000010 // DiffStation (from GGA)
+	LOC_VALID_SPEED       = 0x00000020 // Speed (from RMC or VTG)
+	LOC_VALID_HEADING     = 0x00000040 // Heading (from RMC or VTG)
+	LOC_VALID_MAGHEADING  = 0x00000080 // MagHeading (from VTG)
+	LOC_VALID_ZONE        = 0x00000100 // ZoneHours and ZoneMinutes (from ZDA)
+	LOC_VALID_RMS         = 0x00000200 // Rms (from GST)
+	LOC_VALID_ELLIPSE     = 0x00000400 // ErrMajor, ErrMinor and ErrOrient (from GST)
+	LOC_VALID_SIGMA_LL    = 0x00000800 // SigmaLat and SigmaLon (from GST)
+	LOC_VALID_SIGMA_ALT   = 0x00001000 // SigmaAlt (from GST)
+	LOC_VALID_HACC        = 0x00002000 // HorizontalAccuracy
+	LOC_VALID_VACC        = 0x00004000 // VerticalAccuracy
+	LOC_VALID_EHPE        = 0x00008000 // Garmin.Ehpe (from PGRME)
+	LOC_VALID_EVPE        = 0x00010000 // Garmin.Evpe (from PGRME)
+	LOC_VALID_EPE         = 0x00020000 // Garmin.Epe (from PGRME)
+	LOC_VALID_GARMIN_ALT  = 0x00040000 // Garmin.Alt and Garmin.AltDim (from PGRMZ)
+	LOC_VALID_UBX_HACC    = 0x00080000 // Ubx.HAcc (from PUBX,00)
+	LOC_VALID_UBX_VACC    = 0x00100000 // Ubx.VAcc (from PUBX,00)
+	LOC_VALID_VVEL        = 0x00200000 // Ubx.VVel (from PUBX,00)
+	LOC_VALID_LEAPSEC     = 0x00400000 // Ubx.LeapSec (from PUBX,04)
+	LOC_VALID_CLOCK       = 0x00800000 // Ubx.ClkBias and Ubx.ClkDrift (from PUBX,04)
+	LOC_VALID_TIME        = 0x01000000 // Utc.Hour, Utc.Minute, Utc.Second and Utc.Ms
+	LOC_VALID_DATE        = 0x02000000 // Utc.Year, Utc.Month, Utc.Day and Utc.Dow
+	LOC_VALID_LATLON      = 0x04000000 // Lat and Lon
+	LOC_VALID_ALT         = 0x08000000 // Elv
+	LOC_VALID_MV          = 0x10000000 // Mv
+	LOC_VALID_PDOP        = 0x20000000 // Pdop
+	LOC_VALID_HDOP        = 0x40000000 // Hdop
+	LOC_VALID_VDOP        = 0x80000000 // Vdop
+
+	// Fix delivery policies (Options.Delivery)
+	LOC_DELIVER_BLOCK       = 0 // wait for the user to receive the fix
+	LOC_DELIVER_DROP_NEWEST = 1 // drop the new fix if the channel is full
+	LOC_DELIVER_DROP_OLDEST = 2 // drop the oldest queued fix if the channel is full
+
+	// Cycle boundary detection strategies (Options.Cycle)
+	LOC_CYCLE_SENTENCE  = 0 // a cycle ends with the sentence of type lsdt
+	LOC_CYCLE_TIMESTAMP = 1 // a new GGA/RMC/GLL/GNS time closes the previous cycle
+	LOC_CYCLE_HYBRID    = 2 // whichever of the above comes first
+
+	// Highest satellite ID accepted in GSA and GSV sentences.
+	// All the IDs defined up to NMEA 4.11 (e.g. 301-336 for Galileo or
+	// 401-437 for BeiDou) fit in 3 digits.
+	LOC_MAXSATID = 999
 )
 
+// FixQuality is the GPS quality indicator given by GGA (see the LOC_SIG_XXX
+// constants).
+type FixQuality uint8
+
+var fixQualityNames = [...]string{
+	LOC_SIG_BAD:    "invalid",
+	LOC_SIG_GPS:    "GPS",
+	LOC_SIG_DGPS:   "DGPS",
+	LOC_SIG_PPS:    "PPS",
+	LOC_SIG_RTK:    "RTK fixed",
+	LOC_SIG_FRTK:   "RTK float",
+	LOC_SIG_DR:     "dead reckoning",
+	LOC_SIG_MANUAL: "manual",
+	LOC_SIG_SIM:    "simulator",
+}
+
+func (q FixQuality) String() string {
+	if int(q) < len(fixQualityNames) {
+		return fixQualityNames[q]
+	}
+	return "FixQuality(" + strconv.Itoa(int(q)) + ")"
+}
+
+// IsFix reports whether q denotes an actual position fix computed by the
+// receiver. An invalid fix, a manually entered position or a simulated
+// one is not an actual fix.
+func (q FixQuality) IsFix() bool {
+	return q >= LOC_SIG_GPS && q <= LOC_SIG_DR
+}
+
 // Time structure.
 // The LocTime structure is an equivalent of the Windows SYSTEMTIME structure,
 // described in the MSDN (https://msdn.microsoft.com/fr-fr/library/windows/desktop/ms724950(v=vs.85).aspx).
@@ -56,51 +181,245 @@ type LocTime struct {
 	Ms     uint16
 }
 
+// Time returns t as a time.Time in UTC, or the zero time.Time if t has no
+// date. A leap second (Second = 60) is given as the first second of the
+// next minute.
+func (t LocTime) Time() time.Time {
+	if t.Year == 0 || t.Month == 0 || t.Day == 0 {
+		return time.Time{}
+	}
+	return time.Date(int(t.Year), time.Month(t.Month), int(t.Day),
+		int(t.Hour), int(t.Minute), int(t.Second), int(t.Ms)*int(time.Millisecond), time.UTC)
+}
+
+// NewLocTime returns the LocTime of t, converted to UTC.
+func NewLocTime(t time.Time) LocTime {
+	t = t.UTC()
+	return LocTime{
+		Year:   uint16(t.Year()),
+		Month:  uint16(t.Month()),
+		Dow:    uint16(t.Weekday()),
+		Day:    uint16(t.Day()),
+		Hour:   uint16(t.Hour()),
+		Minute: uint16(t.Minute()),
+		Second: uint16(t.Second()),
+		Ms:     uint16(t.Nanosecond() / int(time.Millisecond)),
+	}
+}
+
 // Information about a satellite.
+// Receivers that track several signals (e.g. L1 and L5) report a satellite
+// once for each of them.
 type LocSat struct {
-	Id      uint8  // Satellite ID
+	Id      uint16 // Satellite ID (1 to LOC_MAXSATID), as given in the sentence
 	Elv     uint8  // Elevation in degrees, 90 maximum
 	Azimuth uint16 // Azimuth, degrees from true north, 000 to 359
 	Sig     uint8  // Signal, 00-99 dB
 	Inuse   bool   // Used in position fix
+
+	Constellation Constellation // GNSS of the satellite (see the LOC_GNSS_XXX constants)
+	Prn           uint16        // PRN within the constellation (slot number for GLONASS)
+	Signal        uint8         // NMEA 4.11 signal ID (0 if not given, see SignalName)
 }
 
 // Location information.
 type LocInfo struct {
-	Level   uint8    // Level of information available for this fix (see the LOC_HAVE_XXX constants)
-	Quality uint8    // GPS quality indicator (0 = Invalid; 1 = Fix; 2 = Differential, 3 = Sensitive)
-	NavMode uint8    // Operating mode, used for navigation (1 = Fix not available; 2 = 2D; 3 = 3D)
-	Smask   uint8    // NMEA sentences processed for this fix
-	Utc     LocTime  // UTC of position
-	Pdop    float32  // Position Dilution Of Precision
-	Hdop    float32  // Horizontal Dilution Of Precision
-	Vdop    float32  // Vertical Dilution Of Precision
-	Lat     float32  // Latitude
-	Lon     float32  // Longitude
-	Elv     float32  // Antenna altitude above/below mean sea level (geoid) in meters
-	Speed   float32  // Speed over the ground in kilometers/hour
-	Heading float32  // Track angle in degrees True
-	Mv      float32  // Magnetic variation degrees (Easterly var. subtracts from true course)
-	Sats    []LocSat // Satellites information
+	Level   uint8      // Level of information available for this fix (see the LOC_HAVE_XXX constants)
+	Caps    uint8      // Capabilities of this fix (see the LOC_CAP_XXX constants)
+	Quality FixQuality // GPS quality indicator (see the LOC_SIG_XXX constants)
+	NavMode uint8      // Operating mode, used for navigation (1 = Fix not available; 2 = 2D; 3 = 3D)
+	Smask   uint32     // NMEA sentences processed for this fix
+	Utc     LocTime    // UTC of position
+	Pdop    float32    // Position Dilution Of Precision
+	Hdop    float32    // Horizontal Dilution Of Precision
+	Vdop    float32    // Vertical Dilution Of Precision
+	Lat     float64    // Latitude
+	Lon     float64    // Longitude
+	Elv     float64    // Antenna altitude above/below mean sea level (geoid) in meters
+	Speed   float32    // Speed over the ground in kilometers/hour
+	Heading float32    // Track angle in degrees True
+	Mv      float32    // Magnetic variation degrees (Easterly var. subtracts from true course)
+	Sats    []LocSat   // Satellites information
+
+	Systems []LocSystem // Per constellation summary, by increasing constellation
+
+	Valid             uint64  // Fields actually given by the sentences of this fix (see the LOC_VALID_XXX constants)
+	NumUsed           uint8   // Number of satellites used for the fix, as given by GGA
+	GeoidSep          float64 // Geoid separation in meters (height of the geoid above the WGS84 ellipsoid)
+	EllipsoidalHeight float64 // Antenna height above the WGS84 ellipsoid in meters (Elv + GeoidSep)
+	DiffAge           float32 // Age of the differential corrections in seconds
+	DiffStation       uint16  // Differential reference station ID (0000-1023)
+
+	Mode      byte // Positioning mode indicator (see the LOC_MODE_XXX constants, 0 if not given)
+	NavStatus byte // Navigational status (see the LOC_NAV_XXX constants, 0 if not given)
+	Unsafe    bool // The fix is estimated, manual, simulated or flagged unsafe by the receiver
+
+	MagHeading float32 // Track angle in degrees Magnetic
+
+	ZoneHours   int8 // Local zone hours (-13 to 13), local time = UTC + zone
+	ZoneMinutes int8 // Local zone minutes (same sign as ZoneHours)
+
+	// Per-constellation mode indicators given by GNS, one LOC_MODE_XXX
+	// character per constellation in the following order: GPS, GLONASS,
+	// Galileo, BeiDou, QZSS, NavIC (e.g. "AAN"). Empty if GNS was not
+	// received.
+	SysModes string
+
+	// Pseudorange error statistics given by GST (1-sigma values in meters).
+	Rms       float32 // RMS value of the standard deviation of the range inputs
+	ErrMajor  float32 // Standard deviation of the semi-major axis of the error ellipse
+	ErrMinor  float32 // Standard deviation of the semi-minor axis of the error ellipse
+	ErrOrient float32 // Orientation of the semi-major axis of the error ellipse (degrees from true north)
+	SigmaLat  float32 // Standard deviation of the latitude error
+	SigmaLon  float32 // Standard deviation of the longitude error
+	SigmaAlt  float32 // Standard deviation of the altitude error
+
+	// Best available accuracy estimates in meters, from GST when present,
+	// otherwise from DOPs multiplied by the UERE given in Options.
+	HorizontalAccuracy float32
+	VerticalAccuracy   float32
+
+	Garmin LocGarmin // Garmin proprietary information
+	Ubx    LocUbx    // u-blox proprietary information
+
+	// Host times at which the first and the last decoded sentences of this
+	// fix were received (see Options.Clock and FeedAt). With the default
+	// clock, they carry a monotonic clock reading.
+	RxFirst time.Time
+	RxLast  time.Time
 }
 
+// HasTime reports whether the fix gives the UTC time.
+func (li *LocInfo) HasTime() bool { return li.Caps&LOC_CAP_TIME != 0 }
+
+// HasDate reports whether the fix gives the UTC date.
+func (li *LocInfo) HasDate() bool { return li.Caps&LOC_CAP_DATE != 0 }
+
+// Has2D reports whether the fix gives the position of an actual fix.
+func (li *LocInfo) Has2D() bool { return li.Caps&LOC_CAP_2D != 0 }
+
+// Has3D reports whether the fix gives the position of an actual fix,
+// with its altitude.
+func (li *LocInfo) Has3D() bool { return li.Caps&LOC_CAP_3D != 0 }
+
+// HasDOP reports whether the fix gives the horizontal and vertical DOPs.
+func (li *LocInfo) HasDOP() bool { return li.Caps&LOC_CAP_DOP != 0 }
+
+// HasSatellites reports whether the fix gives the satellites in view.
+func (li *LocInfo) HasSatellites() bool { return li.Caps&LOC_CAP_SATELLITES != 0 }
+
+// HasAccuracy reports whether the fix gives a horizontal accuracy estimate.
+func (li *LocInfo) HasAccuracy() bool { return li.Caps&LOC_CAP_ACCURACY != 0 }
+
+// HasVelocity reports whether the fix gives the speed and the heading.
+func (li *LocInfo) HasVelocity() bool { return li.Caps&LOC_CAP_VELOCITY != 0 }
+
 // Sentence processing function and minimal validation.
 type fmtS struct {
-	fn	func([]string)	// processing function
-	mf	int				// minimum fields in spliced sentence
+	fn	func(*Decoder, []string)	// processing function
+	mf	int							// minimum fields in spliced sentence
 }
 
-var (
-	// locChan is used to return GNSS fixes to the user. After every cycle of
+// Options configure a Decoder.
+type Options struct {
+	// Lsdt, if non empty, gives the Data Type (e.g. "GPGLL", or "PUBX,04"
+	// for u-blox messages) of the last NMEA sentence in a cycle. If Lsdt
+	// is empty, the decoder will try to determine its value by analyzing
+	// the inter-sentence delay of a few cycles.
+	Lsdt string
+
+	// MinDelay, if not 0, gives the minimal inter-cycle delay in ms (see
+	// Init for details). The default value is 300 ms, shortened to a third
+	// of the cycle period once the output rate of a high-rate receiver
+	// (e.g. 5, 10 or 20 Hz) is known.
+	MinDelay uint
+
+	// QuietPeriod is the delay after which a pending fix is delivered if
+	// no more data is fed to the decoder, e.g. when the receiver stops
+	// mid-stream or when the last sentence of the cycle is corrupted.
+	// The default (0) is the minimal inter-cycle delay, except with
+	// LOC_CYCLE_TIMESTAMP where the next epoch closes the cycle: the flush
+	// timer is then disabled, as with a negative value.
+	QuietPeriod time.Duration
+
+	// Clock, if not nil, gives the time used for all the timing decisions
+	// of the decoder (inter-sentence delays, quiet periods). The default
+	// is the system clock. With a custom Clock, the flush timer is not
+	// used: quiet periods are detected when the next data is fed.
+	Clock Clock
+
+	// UERE is the User Equivalent Range Error in meters, used to estimate
+	// the accuracy of a fix from its DOPs when the receiver does not give
+	// better estimates (e.g. with GST). The default is 5 m.
+	UERE float32
+
+	// BufSize is the capacity of the channel on which the fixes are
+	// delivered. The default is 0 (unbuffered channel).
+	BufSize int
+
+	// Delivery gives the behavior of the decoder when a fix cannot be
+	// delivered immediately (see the LOC_DELIVER_XXX constants). With the
+	// default LOC_DELIVER_BLOCK policy, a slow consumer blocks Feed.
+	// With an unbuffered channel, LOC_DELIVER_DROP_OLDEST behaves like
+	// LOC_DELIVER_DROP_NEWEST.
+	Delivery int
+
+	// Cycle selects the way the end of an NMEA cycle is detected (see the
+	// LOC_CYCLE_XXX constants). The default LOC_CYCLE_SENTENCE strategy
+	// relies on the type of the last sentence of the cycle, which is
+	// learnt from inter-sentence delays if Lsdt is empty.
+	// LOC_CYCLE_TIMESTAMP only relies on the UTC time given by the GGA,
+	// RMC, GLL and GNS sentences, so it does not depend on the speed at
+	// which the decoder is fed. As the end of a cycle is then only known
+	// when the next one begins, fixes are delivered one cycle later.
+	Cycle int
+
+	// OnError, if not nil, is called with a *SentenceError each time an
+	// invalid or unexpected sentence is encountered. The package itself
+	// never prints anything.
+	OnError func(error)
+}
+
+// A Clock gives the current time.
+type Clock interface {
+	Now() time.Time
+}
+
+// The system clock.
+type sysClock struct{}
+
+func (sysClock) Now() time.Time {
+	return time.Now()
+}
+
+// A Decoder converts an NMEA-0183 stream into compiled fixes.
+//
+// All the decoding state is held by the Decoder, so several GNSS receivers
+// can be decoded independently in the same process. Feed should however be
+// called from a single goroutine, as the sentences of a stream must be
+// processed in order.
+type Decoder struct {
+	// dropped counts the fixes dropped by the delivery policy.
+	// It is accessed atomically and kept first for 64-bit alignment.
+	dropped uint64
+
+	// period is the nominal cycle period in ms (0 until known).
+	// It is accessed atomically so that Rate never waits for mu.
+	period int64
+
+	// fixes is used to return GNSS fixes to the user. After every cycle of
 	// NMEA messages, a LocInfo is delivered on this channel.
-	locChan chan *LocInfo
+	fixes chan *LocInfo
 
 	// curLoc is the structure where data is progressivly built.
 	curLoc	LocInfo
 
-	iuBM     [256 / 8]uint8 // bitmap of in use satellites (IDs 0..256, 0 unused)
-	lastGSV  bool           // true when the last GSV message of a burst has been read
-	noGSVcnt uint           // successive fixes without GSV message
+	iuBM     [LOC_GNSS_SBAS + 1][LOC_MAXSATID/8 + 1]uint8 // per constellation bitmap of in use satellites (PRNs 0..LOC_MAXSATID, 0 unused)
+	sys      [LOC_GNSS_SBAS + 1]LocSystem              // per constellation GSA DOPs of the cycle
+	gsv      map[string]*gsvBurst      // GSV bursts, by talker and signal ID
+	gsvKeys  []string                  // keys of gsv, in order of appearance
+	noGSVcnt uint                      // successive fixes without GSV message
+	zdaDate  bool                      // the date of the cycle has been given by ZDA
 
 	// Used for the determination of sentence type at the end of the NMEA cycle.
 	lst    string    		// Last Sentence Type
@@ -108,8 +427,36 @@ var (
 	tst    string    		// temporary lst (copied to lst when nOk is 4)
 	nOk    int       		// # successive cycles ending with lst
 	minDel time.Duration    // minimum delay between two cycles (in ns)
+	autoDel bool			// true if minDel can be adapted to the output rate
 	tPrev  time.Time	 	// Time of previous sentence
+	tRx    time.Time		// Time of the data being processed
+	clock  Clock			// source of tRx for Feed
+	cycle  int				// cycle boundary detection strategy
+	uere   float32			// User Equivalent Range Error (m)
+	epochMs int				// UTC time of the current cycle, in ms since midnight (-1 if unknown)
+	cycTime bool			// the pending cycle has a UTC time
+	pCand   int				// candidate period, confirmed when seen twice
+
+	// Used by Feed to isolate sentences from the stream.
+	feedState int		// frame decoding state
+	feedBuf []byte		// intermediate sentence buffer
+
+	onError func(error)	// error handler (may be nil)
 
+	delivery int		// fix delivery policy
+	done <-chan struct{}	// if not nil, stops a blocked delivery when closed
+
+	// Used to flush the pending fix when the stream goes quiet.
+	// The flush timer runs in its own goroutine, so mu protects the
+	// whole decoding state.
+	mu     sync.Mutex
+	quiet  time.Duration	// quiet period (0 if disabled)
+	timer  *time.Timer		// flush timer (nil until first needed)
+	quit   chan struct{}	// closed by Close
+	closed bool				// true once Close has been called
+}
+
+var (
 	// Sentence processing functions.
 	// We assume that we can ignore the Talker ID (i.e. "GP", "GL", "GA",
 	// "GB" or "GN") in the Address field and focus on the Sentence Formatter
@@ -118,18 +465,151 @@ var (
 	// different satellite numbering ranges are used for different satellite
 	// constellations.
 	fmtFA = map[string]fmtS{
-		"GGA": {doGGA, 10},
-		"GSA": {doGSA, 18},
-		"RMC": {doRMC, 12},
-		"GSV": {doGSV, 4},
-		//"VTG":{doVTG,	9},	// not useful if RMC is OK
+		"GGA": {(*Decoder).doGGA, 10},
+		"GSA": {(*Decoder).doGSA, 18},
+		"RMC": {(*Decoder).doRMC, 12},
+		"GSV": {(*Decoder).doGSV, 4},
+		"GLL": {(*Decoder).doGLL, 7},
+		"ZDA": {(*Decoder).doZDA, 7},
+		"GNS": {(*Decoder).doGNS, 10},
+		"GST": {(*Decoder).doGST, 9},
+		"VTG": {(*Decoder).doVTG, 9},
 	}
 
-	// Used by Feed to isolate sentences from the stream.
-	feedState int = 0	// frame decoding state
-	feedBuf []byte		// intermediate sentence buffer
+	// Index of the UTC time field in the sentences that give one.
+	// Used by the timestamp-based cycle boundary detection.
+	timeF = map[string]int{
+		"GGA":     1,
+		"RMC":     1,
+		"GLL":     5,
+		"GNS":     1,
+		"PUBX,00": 2,
+		"PUBX,04": 2,
+	}
+
+	// Proprietary sentence processing functions.
+	// The whole Address field (e.g. "PGRME") is used as the key.
+	fmtPA = map[string]fmtS{
+		"PGRME": {(*Decoder).doPGRME, 7},
+		"PGRMM": {(*Decoder).doPGRMM, 2},
+		"PGRMZ": {(*Decoder).doPGRMZ, 3},
+		"PGRMT": {(*Decoder).doPGRMT, 2},
+		"PUBX":  {(*Decoder).doPUBX, 2},
+	}
+
+	// defaultDecoder is the Decoder used by the package-level Init, Feed
+	// and Exit functions.
+	defaultDecoder *Decoder
 )
 
+// NewDecoder returns a new Decoder configured by opts.
+//
+// The channel on which the fixes are delivered is created by NewDecoder
+// and can be retrieved with the Fixes method.
+func NewDecoder(opts Options) *Decoder {
+	d := &Decoder{lst: opts.Lsdt, onError: opts.OnError, delivery: opts.Delivery, cycle: opts.Cycle}
+
+	d.uere = opts.UERE
+	if d.uere <= 0 {
+		d.uere = 5 // default to 5 m
+	}
+
+	d.epochMs = -1
+	d.clock = opts.Clock
+	if d.clock == nil {
+		d.clock = sysClock{}
+	}
+
+	if opts.MinDelay == 0 {
+		d.minDel = time.Duration(300) * time.Millisecond	// default to 300 ms
+		d.autoDel = true
+	} else {
+		d.minDel = time.Duration(opts.MinDelay) * time.Millisecond // convert ms to ns
+	}
+
+	switch {
+	case opts.QuietPeriod == 0 && d.cycle != LOC_CYCLE_TIMESTAMP:
+		d.quiet = d.minDel
+	case opts.QuietPeriod > 0:
+		d.quiet = opts.QuietPeriod
+	}
+
+	d.fixes = make(chan *LocInfo, opts.BufSize)
+	d.quit = make(chan struct{})
+	return d
+}
+
+// Fixes returns the channel on which the decoder delivers compiled fixes.
+func (d *Decoder) Fixes() <-chan *LocInfo {
+	return d.fixes
+}
+
+// Rate returns the nominal output rate of the receiver in Hz, as observed
+// from the UTC time of consecutive cycles, or 0 if it is not known yet.
+// It can be called from any goroutine, even while a delivery is blocked.
+func (d *Decoder) Rate() float64 {
+	p := atomic.LoadInt64(&d.period)
+	if p == 0 {
+		return 0
+	}
+	return 1000 / float64(p)
+}
+
+// Dropped returns the number of fixes dropped so far because of the
+// delivery policy of the decoder.
+// It can be called from any goroutine.
+func (d *Decoder) Dropped() uint64 {
+	return atomic.LoadUint64(&d.dropped)
+}
+
+// Close closes the channel returned by Fixes.
+// The decoder must not be fed anymore after Close has been called.
+func (d *Decoder) Close() {
+	close(d.quit) // release a blocked delivery first
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.timer != nil {
+		d.timer.Stop()
+	}
+	d.closed = true
+	close(d.fixes)
+}
+
+// Flush closes the current NMEA cycle and delivers the pending fix, if any,
+// without waiting for the end of the cycle or for the quiet period.
+// With the LOC_DELIVER_BLOCK policy, Flush blocks until the fix is
+// received: it must not be called from the goroutine reading Fixes.
+func (d *Decoder) Flush() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.flush()
+}
+
+// Deliver the pending fix, if any.
+// Called with d.mu held.
+func (d *Decoder) flush() {
+	if d.closed || d.curLoc.Smask == 0 { // nothing pending
+		return
+	}
+	d.deliver(d.getLoc())
+}
+
+// (Re)arm the flush timer if some fix is pending.
+// Called with d.mu held.
+func (d *Decoder) arm() {
+	if _, sys := d.clock.(sysClock); !sys {
+		return // no real time here
+	}
+	if d.quiet == 0 || d.curLoc.Smask == 0 {
+		return
+	}
+	if d.timer == nil {
+		d.timer = time.AfterFunc(d.quiet, d.Flush)
+	} else {
+		d.timer.Reset(d.quiet)
+	}
+}
+
 /*
 // Compute the number of in-use satellites.
 func nInUse(loc *LocInfo) (n uint16) {
@@ -143,33 +623,37 @@ func nInUse(loc *LocInfo) (n uint16) {
 */
 
 // Return a copy of curLoc and reset curLoc for the next fix.
-func getLoc() *LocInfo {
-	// Compute the 'level'
-	curLoc.Level = LOC_HAVE_NOTHING // assume we have nothing serious
-	if curLoc.Smask&GxRMC != 0 {    // RMC
-		if curLoc.Quality != LOC_SIG_BAD { // Active RMC (valid fix)
-			if curLoc.Smask&GxGSA != 0 { // Active RMC, GSA
-				if curLoc.Smask&GxGSV != 0 || len(curLoc.Sats) != 0 { // Active RMC, GSA, GSV
-					curLoc.Level = LOC_HAVE_SATELLITES // 5
-				} else { // Active RMC, GSA
-					curLoc.Level = LOC_HAVE_DOP // 4
-				}
-			} else { // Active RMC
-				if curLoc.Smask&GxGGA != 0 { // Active RMC, GGA
-					curLoc.Level = LOC_HAVE_ALTITUDE // 3
-				} else { // Active RMC alone
-					curLoc.Level = LOC_HAVE_POSITION // 2
-				}
-			}
-		} else { // Void RMC (invalid fix)
-			if curLoc.Utc.Year != 0 {
-				curLoc.Level = LOC_HAVE_TIME // 1
-			}
+func (d *Decoder) getLoc() *LocInfo {
+	// Flag the satellites used, as given by the GSA sentences of the cycle.
+	// The satellites are copied: the previous fix may share them.
+	if d.curLoc.Smask&GxGSA != 0 {
+		sats := make([]LocSat, len(d.curLoc.Sats))
+		for i, s := range d.curLoc.Sats {
+			s.Inuse = d.iuBM[s.Constellation][s.Prn/8]&(1<<(s.Prn%8)) != 0
+			sats[i] = s
 		}
+		d.curLoc.Sats = sats
+	}
+
+	// Give the best available accuracy estimates.
+	d.setAccuracy()
+
+	// Compute the capabilities and the 'level'.
+	d.setCaps()
+	d.curLoc.Systems = d.systems()
+
+	// Flag the fixes that should not be trusted for navigation.
+	switch {
+	case d.curLoc.Mode == LOC_MODE_ESTIMATED, d.curLoc.Mode == LOC_MODE_MANUAL, d.curLoc.Mode == LOC_MODE_SIMULATOR:
+		d.curLoc.Unsafe = true
+	case d.curLoc.NavStatus == LOC_NAV_UNSAFE: // LOC_NAV_NOTVALID only means "not provided"
+		d.curLoc.Unsafe = true
+	case d.curLoc.Quality >= LOC_SIG_DR: // dead reckoning, manual or simulator
+		d.curLoc.Unsafe = true
 	}
 
 	// Here is the fix!
-	lastLoc := curLoc // *allocate* and copy everything
+	lastLoc := d.curLoc // *allocate* and copy everything
 
 	// Prepare data structures for the next fix.
 	//	curLoc = LocInfo{}	// clear the working LocInfo
@@ -177,36 +661,43 @@ func getLoc() *LocInfo {
 	// have to preserve satellite information until a terminal GSV message is
 	// received after the delivery of this fix.
 	// So, clear all but curLoc.Sats.
-	curLoc.Level = 0
-	curLoc.Quality = 0
-	curLoc.NavMode = 0
-	curLoc.Smask = 0
-	curLoc.Utc = LocTime{}
-	curLoc.Pdop = 0
-	curLoc.Hdop = 0
-	curLoc.Vdop = 0
-	curLoc.Lat = 0
-	curLoc.Lon = 0
-	curLoc.Elv = 0
-	curLoc.Speed = 0
-	curLoc.Heading = 0
-	curLoc.Mv = 0
+	d.curLoc = LocInfo{Sats: d.curLoc.Sats}
+	d.cycTime = false
+	d.zdaDate = false
 
 	// If we have 5 consecutive fixes without GSV message, clear curLoc.Sats.
 	if lastLoc.Smask&GxGSV != 0 { // we had GSV for this fix
-		noGSVcnt = 0
+		d.noGSVcnt = 0
 	} else { // no GSV here
-		noGSVcnt++
-		if noGSVcnt >= 4 {
-			curLoc.Sats = []LocSat{}
+		d.noGSVcnt++
+		if d.noGSVcnt >= 4 {
+			d.curLoc.Sats = []LocSat{}
+			d.gsv, d.gsvKeys = nil, nil
+		}
+	}
+
+	// Likewise, forget the talkers and signals whose GSV bursts have not
+	// been received for 5 consecutive fixes.
+	keys := d.gsvKeys[:0]
+	for _, k := range d.gsvKeys {
+		if b := d.gsv[k]; b.age < 4 {
+			b.age++
+			keys = append(keys, k)
+		} else {
+			delete(d.gsv, k)
 		}
 	}
+	if len(keys) != len(d.gsvKeys) {
+		d.gsvKeys = keys
+		d.curLoc.Sats = d.gsvSats()
+	}
 	//fmt.Printf("Smask = 0x%02x, noGSVcnt = %d\n", lastLoc.Smask, noGSVcnt)
 
 	// Clear the in-use satellites bitmap.
 	// We assume that GSA information will be delivered for each fix.
 	//for _, v := range iuBM {fmt.Printf("%02X ", v)};fmt.Println()
-	iuBM = [256 / 8]uint8{}
+	d.iuBM = [LOC_GNSS_SBAS + 1][LOC_MAXSATID/8 + 1]uint8{}
+	d.sys = [LOC_GNSS_SBAS + 1]LocSystem{}
 
 //fmt.Println("FIX")
 	// Return a reference to the allocated LocInfo.
@@ -216,14 +707,99 @@ func getLoc() *LocInfo {
 // Fix latitude or longitude.
 // Input: lat or lon string in degrees and minutes ("ddmm.mmmmm" or "dddmm.mmmmm")
 // Output: same value in degrees (dd.dddddd or ddd.dddddd)
-func fixLG(lg float64) float32 {
-	i, f := math.Modf(float64(lg) / 100) // i = dd.0, f = .mmmmmmmm
-	return float32(i + f*100/60)
+func fixLG(lg float64) float64 {
+	i, f := math.Modf(lg / 100) // i = dd.0, f = .mmmmmmmm
+	return i + f*100/60
+}
+
+// Parse the optional floating point field i.
+// Return false if the field is missing, empty or invalid.
+func parseF(fields []string, i int) (float64, bool) {
+	if i >= len(fields) || fields[i] == "" {
+		return 0, false
+	}
+	f, err := strconv.ParseFloat(fields[i], 64)
+	return f, err == nil
+}
+
+// Parse the latitude or longitude given in degrees and minutes by field i,
+// followed by its hemisphere ("N", "S", "E" or "W") in field i+1.
+// Return the value in degrees, or false if the field is empty or invalid.
+func parseLL(fields []string, i int) (float64, bool) {
+	lg, ok := parseF(fields, i)
+	if !ok || i+1 >= len(fields) {
+		return 0, false
+	}
+	lg = fixLG(lg)
+	if fields[i+1] == "S" || fields[i+1] == "W" {
+		lg = -lg
+	}
+	return lg, true
+}
+
+// Parse a "hhmmss[.sss]" UTC time field into stm.
+// Any number of fractional digits is accepted (".5" is 500 ms); digits
+// beyond the millisecond are ignored.
+// Return false, leaving stm untouched, if the field is not a valid time.
+func parseUtc(field string, stm *LocTime) bool {
+	if len(field) < 6 || (len(field) > 6 && field[6] != '.') {
+		return false
+	}
+	hh, err1 := strconv.Atoi(field[0:2])
+	mm, err2 := strconv.Atoi(field[2:4])
+	ss, err3 := strconv.Atoi(field[4:6])
+	if err1 != nil || err2 != nil || err3 != nil ||
+		hh < 0 || hh > 23 || mm < 0 || mm > 59 || ss < 0 || ss > 60 { // 60 for leap seconds
+		return false
+	}
+	var ms int
+	if len(field) > 7 {
+		frac := (field[7:] + "00")[:3] // milliseconds, right-padded
+		var err error
+		if ms, err = strconv.Atoi(frac); err != nil || ms < 0 {
+			return false
+		}
+	}
+	stm.Hour = uint16(hh)
+	stm.Minute = uint16(mm)
+	stm.Second = uint16(ss)
+	stm.Ms = uint16(ms)
+	return true
+}
+
+// Parse a "ddmmyy" date field into stm and set the day of the week.
+// As the century is not given, years 80 to 99 are assumed to be 1980 to
+// 1999 (GPS time started in 1980) and years 00 to 79 to be 2000 to 2079.
+// Return false, leaving stm untouched, if the field is not a valid date.
+func parseDate(field string, stm *LocTime) bool {
+	if len(field) != 6 {
+		return false
+	}
+	dd, err1 := strconv.Atoi(field[0:2])
+	mm, err2 := strconv.Atoi(field[2:4])
+	yy, err3 := strconv.Atoi(field[4:6])
+	if err1 != nil || err2 != nil || err3 != nil ||
+		dd < 1 || dd > 31 || mm < 1 || mm > 12 || yy < 0 {
+		return false
+	}
+	stm.Day = uint16(dd)
+	stm.Month = uint16(mm)
+	if yy >= 80 {
+		stm.Year = uint16(1900 + yy)
+	} else {
+		stm.Year = uint16(2000 + yy)
+	}
+	fixDow(stm) // set the day of the week
+	return true
 }
 
 // Compute the day of the week from current date.
 // Credits to Tomohiko Sakamoto in sci.math.
 func fixDow(stm *LocTime) {
+	if stm.Month < 1 || stm.Month > 12 { // garbage
+		stm.Dow = 0
+		return
+	}
 	y := stm.Year
 	if stm.Month < 3 {
 		y--
@@ -231,144 +807,491 @@ func fixDow(stm *LocTime) {
 	stm.Dow = (uint16)((y + y/4 - y/100 + y/400 + uint16("-bed=pen+mad."[stm.Month]) + stm.Day) % 7)
 }
 
-// GGA: Global positionning system fix data
-func doGGA(fields []string) {
-	fmt.Sscanf(fields[1], "%2d%2d%2d.%2d", // hhmmss.ss
-		&curLoc.Utc.Hour, &curLoc.Utc.Minute, &curLoc.Utc.Second, &curLoc.Utc.Ms)
-	curLoc.Utc.Ms *= 10
+// Set the UTC time given by field, if valid.
+func (d *Decoder) setUtc(field string) {
+	if parseUtc(field, &d.curLoc.Utc) {
+		d.curLoc.Valid |= LOC_VALID_TIME
+	}
+}
+
+// Set the date given by a "ddmmyy" field, if valid.
+func (d *Decoder) setDate(field string) {
+	if parseDate(field, &d.curLoc.Utc) {
+		d.curLoc.Valid |= LOC_VALID_DATE
+	}
+}
 
-	lat, _ := strconv.ParseFloat(fields[2], 32) // ddmm.mmmmm
-	curLoc.Lat = fixLG(lat)
-	if fields[3] == "S" {
-		curLoc.Lat = -curLoc.Lat
+// Set the position given by the latitude in fields i and i+1 and the
+// longitude in fields i+2 and i+3, if both are valid.
+// The position given by a previous sentence of the cycle is kept otherwise.
+func (d *Decoder) setLatLon(fields []string, i int) {
+	lat, ok1 := parseLL(fields, i)   // ddmm.mmmmm,N
+	lon, ok2 := parseLL(fields, i+2) // dddmm.mmmmm,E
+	if ok1 && ok2 {
+		d.curLoc.Lat = lat
+		d.curLoc.Lon = lon
+		d.curLoc.Valid |= LOC_VALID_LATLON
 	}
+}
 
-	lon, _ := strconv.ParseFloat(fields[4], 32) // dddmm.mmmmm
-	curLoc.Lon = fixLG(lon)
-	if fields[5] == "W" {
-		curLoc.Lon = -curLoc.Lon
+// Set the speed over ground given by field i, converted to km/h by the
+// factor kmh, and the course over ground (degrees) given by field i+1,
+// unless already given by VTG.
+func (d *Decoder) setVelocity(fields []string, i int, kmh float64) {
+	vtg := d.curLoc.Smask&GxVTG != 0
+	if speed, ok := parseF(fields, i); ok && !(vtg && d.curLoc.Valid&LOC_VALID_SPEED != 0) {
+		d.curLoc.Speed = float32(speed * kmh)
+		d.curLoc.Valid |= LOC_VALID_SPEED
 	}
+	if heading, ok := parseF(fields, i+1); ok && !(vtg && d.curLoc.Valid&LOC_VALID_HEADING != 0) {
+		d.curLoc.Heading = float32(heading)
+		d.curLoc.Valid |= LOC_VALID_HEADING
+	}
+}
+
+// Set the DOP given by field i into dop, and the matching valid bit.
+func (d *Decoder) setDOP(fields []string, i int, dop *float32, valid uint64) {
+	if v, ok := parseF(fields, i); ok {
+		*dop = float32(v)
+		d.curLoc.Valid |= valid
+	}
+}
+
+// GGA: Global positionning system fix data
+func (d *Decoder) doGGA(fields []string) {
+	d.setUtc(fields[1]) // hhmmss.sss
+	d.setLatLon(fields, 2)
 
 	q, _ := strconv.Atoi(fields[6])
-	curLoc.Quality = uint8(q)
+	d.curLoc.Quality = FixQuality(q)
+
+	d.setDOP(fields, 8, &d.curLoc.Hdop, LOC_VALID_HDOP) // HDOP (also in GSA)
+
+	if n, err := strconv.Atoi(fields[7]); err == nil && n >= 0 { // satellites used
+		d.curLoc.NumUsed = uint8(n)
+		d.curLoc.Valid |= LOC_VALID_NUMUSED
+	}
+	d.setHeights(fields, 9, 11) // alt(itude), geoid separation
+	d.setDiff(fields, 13, 14)   // age of DGPS data, station ID
+
+	d.curLoc.Smask |= GxGGA
+}
+
+// GNS: GNSS fix data
+func (d *Decoder) doGNS(fields []string) {
+	d.setUtc(fields[1]) // hhmmss.sss
+	d.setLatLon(fields, 2)
+
+	// Per-constellation mode indicators. The overall mode is the one of
+	// the first constellation that contributes to the fix.
+	d.curLoc.SysModes = fields[6]
+	mode := byte(LOC_MODE_NONE)
+	for i := 0; i < len(fields[6]); i++ {
+		if fields[6][i] != LOC_MODE_NONE {
+			mode = fields[6][i]
+			break
+		}
+	}
+	if fields[6] != "" {
+		d.curLoc.Mode = mode
+	}
+	if mode != LOC_MODE_NONE && d.curLoc.Quality == LOC_SIG_BAD {
+		d.curLoc.Quality = modeQuality(mode) // unless given by GGA
+		if d.curLoc.NavMode <= LOC_FIX_BAD { // LOC_FIX_NONE and LOC_FIX_BAD
+			d.curLoc.NavMode = LOC_FIX_2D // assume it will be fixed with GSA.NavMode
+		}
+	}
+
+	if n, err := strconv.Atoi(fields[7]); err == nil && n >= 0 { // satellites used
+		d.curLoc.NumUsed = uint8(n)
+		d.curLoc.Valid |= LOC_VALID_NUMUSED
+	}
+	d.setDOP(fields, 8, &d.curLoc.Hdop, LOC_VALID_HDOP) // HDOP (also in GGA and GSA)
+	d.setHeights(fields, 9, 10) // alt(itude), geoid separation
+	d.setDiff(fields, 11, 12)   // age of differential data, station ID
+	if len(fields) > 13 && len(fields[13]) == 1 { // navigational status (NMEA 4.1+)
+		d.curLoc.NavStatus = fields[13][0]
+	}
+
+	d.curLoc.Smask |= GxGNS
+}
 
-	h, _ := strconv.ParseFloat(fields[8], 32) // HDOP (also in GSA)
-	curLoc.Hdop = float32(h)
+// GST: Pseudorange error statistics
+func (d *Decoder) doGST(fields []string) {
+	d.setUtc(fields[1]) // hhmmss.sss
 
-	a, _ := strconv.ParseFloat(fields[9], 32) // alt(itude)
-	curLoc.Elv = float32(a)
+	if rms, ok := parseF(fields, 2); ok { // RMS of the range inputs
+		d.curLoc.Rms = float32(rms)
+		d.curLoc.Valid |= LOC_VALID_RMS
+	}
+	maj, ok1 := parseF(fields, 3) // error ellipse
+	mnr, ok2 := parseF(fields, 4)
+	ori, ok3 := parseF(fields, 5)
+	if ok1 && ok2 && ok3 {
+		d.curLoc.ErrMajor = float32(maj)
+		d.curLoc.ErrMinor = float32(mnr)
+		d.curLoc.ErrOrient = float32(ori)
+		d.curLoc.Valid |= LOC_VALID_ELLIPSE
+	}
+	slat, ok1 := parseF(fields, 6) // latitude and longitude errors
+	slon, ok2 := parseF(fields, 7)
+	if ok1 && ok2 {
+		d.curLoc.SigmaLat = float32(slat)
+		d.curLoc.SigmaLon = float32(slon)
+		d.curLoc.Valid |= LOC_VALID_SIGMA_LL
+	}
+	if salt, ok := parseF(fields, 8); ok { // altitude error
+		d.curLoc.SigmaAlt = float32(salt)
+		d.curLoc.Valid |= LOC_VALID_SIGMA_ALT
+	}
+
+	d.curLoc.Smask |= GxGST
+}
+
+// Compute the capabilities of the current fix from the fields actually
+// given, whatever the sentences, then derive its level.
+func (d *Decoder) setCaps() {
+	li := &d.curLoc
+	var caps uint8
+	if li.Valid&LOC_VALID_TIME != 0 {
+		caps |= LOC_CAP_TIME
+	}
+	if li.Valid&LOC_VALID_DATE != 0 {
+		caps |= LOC_CAP_DATE
+	}
+	if li.Valid&LOC_VALID_LATLON != 0 && li.Quality.IsFix() {
+		caps |= LOC_CAP_2D
+		if li.Valid&(LOC_VALID_ALT|LOC_VALID_ELLIPSOIDAL) != 0 {
+			caps |= LOC_CAP_3D
+		}
+	}
+	if li.Valid&(LOC_VALID_HDOP|LOC_VALID_VDOP) == LOC_VALID_HDOP|LOC_VALID_VDOP {
+		caps |= LOC_CAP_DOP
+	}
+	if li.Smask&(GxGSV|PUBX03) != 0 || len(li.Sats) != 0 {
+		caps |= LOC_CAP_SATELLITES
+	}
+	if li.Valid&LOC_VALID_HACC != 0 {
+		caps |= LOC_CAP_ACCURACY
+	}
+	if li.Valid&(LOC_VALID_SPEED|LOC_VALID_HEADING) == LOC_VALID_SPEED|LOC_VALID_HEADING {
+		caps |= LOC_CAP_VELOCITY
+	}
+	li.Caps = caps
+
+	// Each level from LOC_HAVE_POSITION requires the capabilities of the
+	// previous ones, but the date may be missing (e.g. GGA and GSA only).
+	li.Level = LOC_HAVE_NOTHING
+	if caps&(LOC_CAP_TIME|LOC_CAP_DATE) == LOC_CAP_TIME|LOC_CAP_DATE {
+		li.Level = LOC_HAVE_TIME
+	}
+	for _, l := range [...]struct {
+		level uint8
+		caps  uint8
+	}{
+		{LOC_HAVE_POSITION, LOC_CAP_2D},
+		{LOC_HAVE_ALTITUDE, LOC_CAP_3D},
+		{LOC_HAVE_DOP, LOC_CAP_DOP},
+		{LOC_HAVE_SATELLITES, LOC_CAP_SATELLITES},
+	} {
+		if caps&l.caps != l.caps {
+			break
+		}
+		li.Level = l.level
+	}
+}
+
+// Compute the best available horizontal and vertical accuracy estimates:
+// GST statistics if any, u-blox or Garmin estimated errors, or DOPs
+// multiplied by the UERE otherwise (for actual fixes only).
+func (d *Decoder) setAccuracy() {
+	li := &d.curLoc
+	fix := li.Quality.IsFix()
+	switch {
+	case li.Valid&LOC_VALID_SIGMA_LL != 0:
+		li.HorizontalAccuracy = float32(math.Hypot(float64(li.SigmaLat), float64(li.SigmaLon)))
+		li.Valid |= LOC_VALID_HACC
+	case li.Valid&LOC_VALID_UBX_HACC != 0:
+		li.HorizontalAccuracy = li.Ubx.HAcc
+		li.Valid |= LOC_VALID_HACC
+	case li.Valid&LOC_VALID_EHPE != 0:
+		li.HorizontalAccuracy = li.Garmin.Ehpe
+		li.Valid |= LOC_VALID_HACC
+	case li.Valid&LOC_VALID_HDOP != 0 && fix:
+		li.HorizontalAccuracy = li.Hdop * d.uere
+		li.Valid |= LOC_VALID_HACC
+	}
+	switch {
+	case li.Valid&LOC_VALID_SIGMA_ALT != 0:
+		li.VerticalAccuracy = li.SigmaAlt
+		li.Valid |= LOC_VALID_VACC
+	case li.Valid&LOC_VALID_UBX_VACC != 0:
+		li.VerticalAccuracy = li.Ubx.VAcc
+		li.Valid |= LOC_VALID_VACC
+	case li.Valid&LOC_VALID_EVPE != 0:
+		li.VerticalAccuracy = li.Garmin.Evpe
+		li.Valid |= LOC_VALID_VACC
+	case li.Valid&LOC_VALID_VDOP != 0 && fix:
+		li.VerticalAccuracy = li.Vdop * d.uere
+		li.Valid |= LOC_VALID_VACC
+	}
+}
+
+// Set the altitude and the geoid separation given by fields alt and sep of
+// a GGA or GNS sentence.
+func (d *Decoder) setHeights(fields []string, alt, sep int) {
+	a, aok := parseF(fields, alt)
+	if aok {
+		d.curLoc.Elv = a
+		d.curLoc.Valid |= LOC_VALID_ALT
+	}
 
-	curLoc.Smask |= GxGGA
+	if sep, ok := parseF(fields, sep); ok {
+		d.curLoc.GeoidSep = sep
+		d.curLoc.Valid |= LOC_VALID_GEOIDSEP
+		if aok {
+			d.curLoc.EllipsoidalHeight = a + sep
+			d.curLoc.Valid |= LOC_VALID_ELLIPSOIDAL
+		}
+	}
+}
+
+// Set the age of the differential corrections and the reference station ID
+// given by fields age and station of a GGA or GNS sentence.
+func (d *Decoder) setDiff(fields []string, age, station int) {
+	if a, ok := parseF(fields, age); ok {
+		d.curLoc.DiffAge = float32(a)
+		d.curLoc.Valid |= LOC_VALID_DIFFAGE
+	}
+	if station < len(fields) {
+		if id, err := strconv.Atoi(fields[station]); err == nil && id >= 0 && id <= 1023 {
+			d.curLoc.DiffStation = uint16(id)
+			d.curLoc.Valid |= LOC_VALID_DIFFSTATION
+		}
+	}
 }
 
 // RMC: Recommended Minimum data
-func doRMC(fields []string) {
-	fmt.Sscanf(fields[1], "%2d%2d%2d.%2d", // hhmmss.ss
-		&curLoc.Utc.Hour, &curLoc.Utc.Minute, &curLoc.Utc.Second, &curLoc.Utc.Ms)
-	curLoc.Utc.Ms *= 10
+func (d *Decoder) doRMC(fields []string) {
+	d.setUtc(fields[1]) // hhmmss.sss
+	d.setLatLon(fields, 3)
+
+	d.setVelocity(fields, 7, 1.852) // speed over ground (knots)
+
+	if !d.zdaDate { // prefer the 4-digit year of ZDA
+		d.setDate(fields[9]) // ddmmyy
+	}
+
+	if mv, ok := parseF(fields, 10); ok { // magnetic variation (degrees)
+		d.curLoc.Mv = float32(mv)
+		if fields[11] == "W" { // @@@ NOT SURE OF THIS!
+			d.curLoc.Mv = -d.curLoc.Mv
+		}
+		d.curLoc.Valid |= LOC_VALID_MV
+	}
+
+	// Mode indicator (NMEA 2.3+) and navigational status (NMEA 4.1+).
+	if len(fields) > 12 {
+		d.setMode(fields[12])
+	}
+	if len(fields) > 13 && len(fields[13]) == 1 {
+		d.curLoc.NavStatus = fields[13][0]
+	}
+
+	d.setStatus(fields[2])
+
+	d.curLoc.Smask |= GxRMC
+}
+
+// GLL: Geographic position, latitude / longitude
+func (d *Decoder) doGLL(fields []string) {
+	// Keep the position given by RMC if the GLL one is empty.
+	d.setLatLon(fields, 1)
+	d.setUtc(fields[5]) // hhmmss.sss
 
-	lat, _ := strconv.ParseFloat(fields[3], 32) // ddmm.mmmmm
-	curLoc.Lat = fixLG(lat)
-	if fields[4] == "S" {
-		curLoc.Lat = -curLoc.Lat
+	if len(fields) > 7 { // mode indicator (NMEA 2.3+)
+		d.setMode(fields[7])
 	}
 
-	lon, _ := strconv.ParseFloat(fields[5], 32) // dddmm.mmmmm
-	curLoc.Lon = fixLG(lon)
-	if fields[6] == "W" {
-		curLoc.Lon = -curLoc.Lon
+	d.setStatus(fields[6])
+
+	d.curLoc.Smask |= GxGLL
+}
+
+// ZDA: Time and date
+// The date given by ZDA takes precedence over the one of RMC.
+func (d *Decoder) doZDA(fields []string) {
+	d.setUtc(fields[1]) // hhmmss.sss
+
+	day, err1 := strconv.Atoi(fields[2])
+	month, err2 := strconv.Atoi(fields[3])
+	year, err3 := strconv.Atoi(fields[4])
+	if err1 == nil && err2 == nil && err3 == nil &&
+		day >= 1 && day <= 31 && month >= 1 && month <= 12 && year > 0 && year <= 9999 {
+		d.curLoc.Utc.Day = uint16(day)
+		d.curLoc.Utc.Month = uint16(month)
+		d.curLoc.Utc.Year = uint16(year)
+		fixDow(&d.curLoc.Utc) // set the day of the week
+		d.curLoc.Valid |= LOC_VALID_DATE
+		d.zdaDate = true
 	}
 
-	speed, _ := strconv.ParseFloat(fields[7], 32) // speed over ground (knots)
-	curLoc.Speed = float32(speed * 1.852)         // km/h
+	zh, err1 := strconv.Atoi(fields[5]) // local zone hours
+	zm, err2 := strconv.Atoi(fields[6]) // local zone minutes
+	if err1 == nil && err2 == nil && zh >= -13 && zh <= 13 && zm >= -59 && zm <= 59 {
+		if zh < 0 || strings.HasPrefix(fields[5], "-") { // e.g. "-00,30"
+			zm = -abs(zm)
+		}
+		d.curLoc.ZoneHours = int8(zh)
+		d.curLoc.ZoneMinutes = int8(zm)
+		d.curLoc.Valid |= LOC_VALID_ZONE
+	}
+
+	d.curLoc.Smask |= GxZDA
+}
 
-	heading, _ := strconv.ParseFloat(fields[8], 32) // course over ground (degrees)
-	curLoc.Heading = float32(heading)
+func abs(i int) int {
+	if i < 0 {
+		return -i
+	}
+	return i
+}
 
-	fmt.Sscanf(fields[9], "%2d%2d%2d", // ddmmyy
-		&curLoc.Utc.Day, &curLoc.Utc.Month, &curLoc.Utc.Year)
-	curLoc.Utc.Year += 2000
-	fixDow(&curLoc.Utc) // set the day of the week
+// Record the positioning mode indicator given by an RMC, GLL, VTG or GNS
+// sentence.
+func (d *Decoder) setMode(field string) {
+	if len(field) == 1 {
+		d.curLoc.Mode = field[0]
+	}
+}
 
-	mv, _ := strconv.ParseFloat(fields[10], 32) // magnetic variation (degrees)
-	curLoc.Mv = float32(mv)
-	if fields[11] == "W" { // @@@ NOT SURE OF THIS!
-		curLoc.Mv = -curLoc.Mv
+// Return the fix quality matching a positioning mode indicator.
+// LOC_SIG_GPS is assumed when the mode is unknown, and LOC_SIG_BAD is
+// returned for LOC_MODE_NONE (data not valid).
+func modeQuality(mode byte) FixQuality {
+	switch mode {
+	case LOC_MODE_NONE:
+		return LOC_SIG_BAD
+	case LOC_MODE_DIFFERENTIAL:
+		return LOC_SIG_DGPS
+	case LOC_MODE_ESTIMATED:
+		return LOC_SIG_DR
+	case LOC_MODE_FLOAT_RTK:
+		return LOC_SIG_FRTK
+	case LOC_MODE_RTK:
+		return LOC_SIG_RTK
+	case LOC_MODE_PRECISE:
+		return LOC_SIG_PPS
+	case LOC_MODE_MANUAL:
+		return LOC_SIG_MANUAL
+	case LOC_MODE_SIMULATOR:
+		return LOC_SIG_SIM
 	}
+	return LOC_SIG_GPS
+}
 
-	switch fields[2] { // status
+// Record the status given by an RMC or GLL sentence.
+// An active status gives a 2D fix of the quality implied by the mode
+// indicator until GGA and GSA tell more.
+func (d *Decoder) setStatus(field string) {
+	switch field {
 	case "A": // Active
-		if curLoc.Quality == LOC_SIG_BAD {
-			curLoc.Quality = LOC_SIG_GPS // assume it will be fixed with GGA.Quality
+		if d.curLoc.Quality == LOC_SIG_BAD {
+			d.curLoc.Quality = modeQuality(d.curLoc.Mode) // assume it will be fixed with GGA.Quality
 		}
-		if curLoc.NavMode <= LOC_FIX_BAD { // LOC_FIX_NONE and LOC_FIX_BAD
-			curLoc.NavMode = LOC_FIX_2D // assume it will be fixed with GSA.NavMode
+		if d.curLoc.Quality.IsFix() && d.curLoc.NavMode <= LOC_FIX_BAD { // LOC_FIX_NONE and LOC_FIX_BAD
+			d.curLoc.NavMode = LOC_FIX_2D // assume it will be fixed with GSA.NavMode
 		}
 	case "V": // Void
-		curLoc.Quality = LOC_SIG_BAD
-		curLoc.NavMode = LOC_FIX_BAD
+		d.curLoc.Quality = LOC_SIG_BAD
+		d.curLoc.NavMode = LOC_FIX_BAD
 	}
-
-	curLoc.Smask |= GxRMC
 }
 
-/*
 // VTG: course over ground and ground speed
-func doVTG(fields []string) {
-	if fields[2] == "T" {
-		h, _ := strconv.ParseFloat(fields[1], 32)	// course over ground (true) (degrees)
-		curLoc.heading = float32(h)
-	}
-	if fields[8] == "K" {
-		k, _ := strconv.ParseFloat(fields[7], 32)	// speed over ground (km/h)
-		curLoc.speed = float32(k)
-	} else {
-		if fields[6] == "N" {
-			k, _ := strconv.ParseFloat(fields[5], 32)	// speed over ground (knots)
-			curLoc.speed = float32(k * 1.852)			// km/h
+// VTG takes precedence over RMC for speed and heading.
+func (d *Decoder) doVTG(fields []string) {
+	if h, ok := parseF(fields, 1); ok && fields[2] == "T" { // course over ground (true) (degrees)
+		d.curLoc.Heading = float32(h)
+		d.curLoc.Valid |= LOC_VALID_HEADING
+	}
+	if h, ok := parseF(fields, 3); ok && fields[4] == "M" { // course over ground (magnetic) (degrees)
+		d.curLoc.MagHeading = float32(h)
+		d.curLoc.Valid |= LOC_VALID_MAGHEADING
+	}
+	if k, ok := parseF(fields, 7); ok && fields[8] == "K" {
+		d.curLoc.Speed = float32(k) // speed over ground (km/h)
+		d.curLoc.Valid |= LOC_VALID_SPEED
+	} else if k, ok := parseF(fields, 5); ok && fields[6] == "N" {
+		d.curLoc.Speed = float32(k * 1.852) // speed over ground (knots), km/h
+		d.curLoc.Valid |= LOC_VALID_SPEED
+	}
+
+	if len(fields) > 9 { // mode indicator (NMEA 2.3+)
+		d.setMode(fields[9])
 	}
 
-	curLoc.Smask |= GxVTG
+	d.curLoc.Smask |= GxVTG
 }
-*/
 
 // GSA: DOP and active satellites
-func doGSA(fields []string) {
+func (d *Decoder) doGSA(fields []string) {
 	m, _ := strconv.Atoi(fields[2]) // navMode
-	curLoc.NavMode = uint8(m)
+	d.curLoc.NavMode = uint8(m)
+
+	// Get the constellation of the satellites used for navigation: the
+	// NMEA 4.11 system ID if any, else the talker. GNGSA sentences without
+	// system ID rely on the extended numbering (see satPrn).
+	c := talkerGNSS[fields[0][:2]]
+	if len(fields) > 18 {
+		if sys, err := strconv.Atoi(fields[18]); err == nil && sys >= 1 && sys <= int(LOC_GNSS_NAVIC) {
+			c = Constellation(sys)
+		}
+	}
 
 	// Get the ids of the satellites used for navigation.
-	// GPS, Galileo and Glonass GGA messages can be processed here.
-	// GPS satellites are numbered from 1 to 32.
-	// Glonass satellites are numbered from 65 to 96.
-	// Beidou satellites are (possibly) numbered from 201 to 235.
-	// Galileo satellites numbering is currently unknown.
-	// We just expect that the final overall numbering will be consistent
-	// enough to avoid collisions!
+	// NMEA 4.0 GNGSA sentences give one constellation each: their DOPs are
+	// given to the constellation of their first satellite.
+	owner := c
 	for i := 3; i < 3+12; i++ { // 12 satellites maximum per GSA sentence
-		id, _ := strconv.Atoi(fields[i]) // satellite number (1-255 expected)
+		id, _ := strconv.Atoi(fields[i]) // satellite number (1-LOC_MAXSATID expected)
 		if id == 0 {
 			continue
 		}
-		if id > 255 {
-			panic(fmt.Sprintf("UNEXPECTED SATELLITE NUMBER IN %s: %d!", fields[0], id))
+		if id < 0 || id > LOC_MAXSATID {
+			d.report(joinS(fields), fmt.Errorf("%w: %d", ErrSatID, id))
+			continue // ignore this one
+		}
+		sc, prn := satPrn(c, id)
+		d.iuBM[sc][prn/8] |= 1 << (prn % 8) // 8-bit per iuBM entry
+		if owner == LOC_GNSS_UNKNOWN {
+			owner = sc
 		}
-		iuBM[id/8] |= 1 << (uint)(id%8) // 8-bit per iuBM entry
 	}
 
 	// Get the DOPs now.
-	pdop, _ := strconv.ParseFloat(fields[15], 32) // PDOP
-	curLoc.Pdop = float32(pdop)
-	hdop, _ := strconv.ParseFloat(fields[16], 32) // HDOP (also in GGA)
-	curLoc.Hdop = float32(hdop)
-	vdop, _ := strconv.ParseFloat(fields[17], 32) // VDOP
-	curLoc.Vdop = float32(vdop)
+	pdop, okp := parseF(fields, 15) // PDOP
+	hdop, okh := parseF(fields, 16) // HDOP (also in GGA)
+	vdop, okv := parseF(fields, 17) // VDOP
+	if owner != LOC_GNSS_UNKNOWN && okp && okh && okv {
+		ls := &d.sys[owner]
+		ls.Pdop, ls.Hdop, ls.Vdop = float32(pdop), float32(hdop), float32(vdop)
+		ls.HasDOP = true
+	}
+
+	// Receivers that send a GSA per constellation give the DOPs of the
+	// combined solution in each of them: keep the first ones.
+	if d.curLoc.Smask&GxGSA == 0 {
+		d.setDOP(fields, 15, &d.curLoc.Pdop, LOC_VALID_PDOP)
+		d.setDOP(fields, 16, &d.curLoc.Hdop, LOC_VALID_HDOP)
+		d.setDOP(fields, 17, &d.curLoc.Vdop, LOC_VALID_VDOP)
+	}
 
-	curLoc.Smask |= GxGSA
+	d.curLoc.Smask |= GxGSA
 }
 
 // GSV: Satelites in View
-func doGSV(fields []string) {
+func (d *Decoder) doGSV(fields []string) {
 	// Retrieve a few values from the message.
 	numMsg, _ := strconv.Atoi(fields[1]) // expected number of GSV messages
 	msgNum, _ := strconv.Atoi(fields[2]) // number of this message (1,2,3)
@@ -379,84 +1302,123 @@ func doGSV(fields []string) {
 	// If msgNum == numMsg, it should be 1 + numSV % 4.
 	// Please note that a GSV message with NO satellite is possible, like in
 	// the "$GPGSV,1,1,00*79" that can be returned by ublox NEO-M8.
-	if msgNum > numMsg || numSV < 0 || numMsg != (numSV+3)/4 {
-		fmt.Printf("Invalid GSV message: %v\n", fields)
+	if msgNum < 1 || msgNum > numMsg || numSV < 0 || (numMsg != (numSV+3)/4 && !(numSV == 0 && numMsg == 1)) {
+		d.report(joinS(fields), ErrInvalidGSV)
 		return
 	}
 	ns := 4               // assume full
 	if msgNum == numMsg { // last message
 		ns = (numSV-1)%4 + 1 // 1, 2, 3, 4 (0 when numSV is 0)
 	}
-	fmt.Printf("numMsg = %d, msgNum = %d, numSV = %d, ns = %d\n", numMsg, msgNum, numSV, ns)
 	if len(fields) < 4 + 4 * ns {
-		fmt.Printf("%d < %d\n", len(fields), 4 + 4 * ns)
-		fmt.Printf("Invalid GSV message: %v\n", fields)
+		d.report(joinS(fields), fmt.Errorf("%w: %d fields for %d satellites", ErrInvalidGSV, len(fields), ns))
 		return
 	}
 
-	// Consider cleaning curLoc.Sats if a 'first' GSV message comes after a
-	// 'final' GSV message, i.e. if a new GPGSV set begins.
-	// The lastGSV boolean is true right after the 'final' GSV message has
-	// been processed (see bellow).
-	// WARNING: it is here assumed that if GxGSV messages are issued for
-	// several constellations, the first one for the GPS (i.e. GPGSV).
-	 // dont reset Sats if not GPGSV
-	if lastGSV && fields[0][1] == 'P' {
-		lastGSV = false
-		curLoc.Sats = []LocSat{}
+	// Get the constellation from the talker (extended numbering for GN)
+	// and the signal from the NMEA 4.11 signal ID, that is the last field
+	// (satellite fields may have been padded).
+	talker := fields[0][:2]
+	c := talkerGNSS[talker]
+	key := talker
+	var sig uint8
+	if (len(fields)-4)%4 == 1 {
+		key += "," + fields[len(fields)-1]
+		s, _ := strconv.ParseUint(fields[len(fields)-1], 16, 8) // hexadecimal
+		sig = uint8(s)
 	}
 
-	// Check whether this is the last GSV sentence of a GSV burst.
-	if msgNum == numMsg { // last GSV sentence of a GSV burst
-		lastGSV = true
+	// GSV bursts are tracked independently for each talker and signal:
+	// a burst replaces the satellites given by the previous one only once
+	// its final message has been received.
+	b := d.gsv[key]
+	if b == nil {
+		if d.gsv == nil {
+			d.gsv = make(map[string]*gsvBurst)
+		}
+		b = &gsvBurst{}
+		d.gsv[key] = b
+		d.gsvKeys = append(d.gsvKeys, key)
+	}
+	if msgNum == 1 { // first GSV sentence of a GSV burst
+		b.cur = nil
 	}
 
-	// Append given satellite information to curLoc.Sats.
+	// Append given satellite information to the burst.
 	var ls LocSat
 	for i := 0; i < ns; i++ {
 		sv, _ := strconv.Atoi(fields[4+i*4+0]) // satelite ID
-		if sv == 0 || uint(sv) > 255 {
-			fmt.Printf("UNEXPECTED SATELLITE NUMBER IN %s: %02d\n", fields[0], sv)
+		if sv <= 0 || uint(sv) > LOC_MAXSATID {
+			d.report(joinS(fields), fmt.Errorf("%w: %02d", ErrSatID, sv))
 			return
 		}
 		elv, _ := strconv.Atoi(fields[4+i*4+1]) // elevation
 		az, _ := strconv.Atoi(fields[4+i*4+2])  // azimuth
 		cno, _ := strconv.Atoi(fields[4+i*4+3]) // signal strength
 
-		ls.Id = uint8(sv)
+		ls.Id = uint16(sv)
 		ls.Elv = uint8(elv)
 		ls.Azimuth = uint16(az)
 		ls.Sig = uint8(cno)
-		ls.Inuse = (iuBM[sv/8] & (1 << (uint(sv) % 8))) != 0
+		ls.Constellation, ls.Prn = satPrn(c, sv)
+		ls.Signal = sig
+
+		b.cur = append(b.cur, ls)
+	}
+
+	// Check whether this is the last GSV sentence of a GSV burst.
+	if msgNum == numMsg { // last GSV sentence of a GSV burst
+		b.sats, b.cur = b.cur, nil
+		b.age = 0
+		d.curLoc.Sats = d.gsvSats() // len(curLoc.Sats) gives the number of satellites in view
+	}
 
-		curLoc.Sats = append(curLoc.Sats, ls) // len(curLoc.Sats) gives the number of satellites in view
+	switch c {
+	case LOC_GNSS_GLONASS:
+		d.curLoc.Smask |= GLGSV
+	case LOC_GNSS_GALILEO:
+		d.curLoc.Smask |= GAGSV
 	}
+	d.curLoc.Smask |= GxGSV
+}
 
-	curLoc.Smask |= GxGSV
+// Satellites given by the GSV bursts of a talker for a signal.
+type gsvBurst struct {
+	sats []LocSat // satellites of the last complete burst
+	cur  []LocSat // satellites of the burst being received
+	age  uint     // fixes since sats has been updated
+}
+
+// Return the satellites of all the complete GSV bursts.
+func (d *Decoder) gsvSats() []LocSat {
+	sats := []LocSat{}
+	for _, k := range d.gsvKeys {
+		sats = append(sats, d.gsv[k].sats...)
+	}
+	return sats
 }
 
 // Check if the given (spliced) sentence is the last one in the NMEA cycle.
-func checkCycle(ss []string) bool {
-	if lst != "" { // known Last Sequence Data Type
-		if ss[0] == lst { // match
+func (d *Decoder) checkCycle(ss []string) bool {
+	if d.lst != "" { // known Last Sequence Data Type
+		if sentenceType(ss) == d.lst { // match
 			// If the cycle ends with a GSV, we have to check that
 			// the sentence is the last one in the GSV burst.
 			sf := ss[0][2:] // Sequence Formatter
-			return sf != "GSV" || (sf == "GSV" && (ss[1] == ss[2]))
+			return sf != "GSV" || (sf == "GSV" && len(ss) > 2 && (ss[1] == ss[2]))
 		}
 	} else { // try to determine lst
-		if pst != "" { // we have received a sentence before (tPrev.IsZero() is false)
-			if time.Since(tPrev) >= minDel { // delay big enough
+		if d.pst != "" { // we have received a sentence before (tPrev.IsZero() is false)
+			if d.tRx.Sub(d.tPrev) >= d.minDel { // delay big enough
 				// pst is a candidate
-				if pst == tst {
-					nOk++
-					if nOk == 4 { // consecutive matches
-						lst = pst // voila!
-						fmt.Printf("\n*** lst = %s ***\n\n", lst)
+				if d.pst == d.tst {
+					d.nOk++
+					if d.nOk == 4 { // consecutive matches
+						d.lst = d.pst // voila!
 					}
 				} else {
-					tst = pst
-					nOk = 0
+					d.tst = d.pst
+					d.nOk = 0
 				}
 			}
 		}
@@ -464,6 +1426,72 @@ func checkCycle(ss []string) bool {
 	return false
 }
 
+// Return the type of a (spliced) sentence: its address field (e.g. "GPRMC"),
+// followed by the message ID for u-blox sentences (e.g. "PUBX,04").
+func sentenceType(ss []string) string {
+	if ss[0] == "PUBX" && len(ss) > 1 {
+		return ss[0] + "," + ss[1]
+	}
+	return ss[0]
+}
+
+// Check if the given (spliced) sentence gives a UTC time (timed) and if
+// this time starts a new epoch, i.e. differs from the one of the current
+// cycle (isNew).
+func (d *Decoder) newEpoch(ss []string) (timed, isNew bool) {
+	key := sentenceType(ss)
+	if key[0] != 'P' { // ignore the talker, but PGRMC is not RMC
+		key = key[2:]
+	}
+	i, ok := timeF[key]
+	if !ok || len(ss) <= i || ss[i] == "" { // no time here
+		return false, false
+	}
+	var stm LocTime
+	if !parseUtc(ss[i], &stm) {
+		return false, false
+	}
+	ms := ((int(stm.Hour)*60+int(stm.Minute))*60+int(stm.Second))*1000 + int(stm.Ms)
+	if ms == d.epochMs { // e.g. "123519" and "123519.00"
+		return true, false
+	}
+	prev := d.epochMs
+	d.epochMs = ms
+	d.checkRate(prev, ms)
+	return true, prev >= 0 // not the first epoch
+}
+
+// Update the estimation of the nominal output rate with the UTC time of a
+// new epoch (ms) and the one of the previous epoch (prev, -1 if unknown).
+// A period is adopted when two consecutive epochs show the same interval.
+// Unless a minimal inter-cycle delay was given by the user, it is then
+// shortened if needed so that high-rate receivers (e.g. 10 or 20 Hz) get
+// valid cycles.
+func (d *Decoder) checkRate(prev, ms int) {
+	if prev < 0 {
+		return
+	}
+	p := ms - prev
+	if p < 0 { // midnight rollover
+		p += 24 * 3600 * 1000
+	}
+	if p == 0 || p > 60*1000 { // not a plausible period
+		d.pCand = 0
+		return
+	}
+	if p != d.pCand {
+		d.pCand = p
+		return
+	}
+	atomic.StoreInt64(&d.period, int64(p)) // seen twice in a row
+	if d.autoDel {
+		d.minDel = time.Duration(300) * time.Millisecond
+		if del := time.Duration(p) * time.Millisecond / 3; del < d.minDel {
+			d.minDel = del // leave room for the sentences of the cycle
+		}
+	}
+}
+
 func cleanS(sentence []byte) string {
 	n := len(sentence)
 	for n != 0 {
@@ -478,20 +1506,24 @@ func cleanS(sentence []byte) string {
 // Process an NMEA-183 sentence.
 // Expected: '$...,...,...,...,... * H1 H2 CR LF'
 //   len +                        -5 -4 -3 -2 -1
-func processSentence(sentence []byte) {
+func (d *Decoder) processSentence(sentence []byte) {
 	//fmt.Printf("\nSentence: %s", string(sentence))
 	// First make some validation.
 	n := len(sentence)
 	if n < 3+8 { // should be refined!
-		fmt.Printf("%s: sentence too short (%d bytes)!\n", cleanS(sentence), n)
+		d.report(cleanS(sentence), fmt.Errorf("%w (%d bytes)", ErrTooShort, n))
 		return
 	}
-	if n > 82 {
-		fmt.Printf("%s: sentence too long (%d bytes)!\n", cleanS(sentence), n)
+	maxLen := 82            // NMEA-0183 limit
+	if sentence[1] == 'P' { // proprietary sentences can be longer (e.g. PUBX,03)
+		maxLen = 1024
+	}
+	if n > maxLen {
+		d.report(cleanS(sentence), fmt.Errorf("%w (%d bytes)", ErrTooLong, n))
 		return
 	}
 	if sentence[n-2] != '\r' {
-		fmt.Printf("%s: missing CR!\n", cleanS(sentence))
+		d.report(cleanS(sentence), ErrMissingCR)
 		return
 	}
 	n -= 2                  // ignore trailing CR+LF
@@ -503,7 +1535,7 @@ func processSentence(sentence []byte) {
 		}
 		scs, _ := strconv.ParseUint(string(sentence[m+1:m+3]), 16, 8)
 		if byte(scs) != ccs {
-			fmt.Printf("%s: bad checksum: %02X != %02X\n", cleanS(sentence), scs, ccs)
+			d.report(cleanS(sentence), fmt.Errorf("%w: %02X != %02X", ErrChecksum, scs, ccs))
 			return
 		}
 		n = m // checksum OK: take this new length
@@ -515,26 +1547,53 @@ func processSentence(sentence []byte) {
 	// Extract all the fields, skipping leading '$'.
 	ss := strings.Split(string(sentence[1:n]), ",")
 	//fmt.Println(ss)
+	if len(ss[0]) < 3 { // not even a Sequence Formatter
+		d.report(cleanS(sentence), ErrAddress)
+		return
+	}
 
 	// Keep on determining the end of the NMEA cycle.
 	// Do this before checking the Sequence Formatter, as the cycle
 	// can be terminated by a sentence we don't process.
-	eoc := checkCycle(ss)
+	// With a timestamp-based strategy, a sentence showing a new UTC time
+	// closes the previous cycle before being processed.
+	var eoc bool
+	if d.cycle != LOC_CYCLE_TIMESTAMP {
+		eoc = d.checkCycle(ss)
+	}
+	// Sentences without time that start a cycle after a quiet period
+	// (e.g. GSA before GGA) are kept for the new epoch.
+	timed, isNew := d.newEpoch(ss)
+	if isNew && d.cycle != LOC_CYCLE_SENTENCE && d.cycTime {
+		d.flush()
+	}
+	d.cycTime = d.cycTime || timed
 
 	// Save the time when we received this sentence and save its type as
 	// the "previous sequence type".
-	tPrev = time.Now()
-	pst = ss[0]
+	d.tPrev = d.tRx
+	d.pst = sentenceType(ss)
 
 	// Keep on processing according to the Sequence Formatter.
-	// Ignore the 2-letters Target ID that precede it.
-	fmts, ok := fmtFA[ss[0][2:]]
+	// Ignore the 2-letters Target ID that precede it, unless this is a
+	// proprietary sentence.
+	var fmts fmtS
+	var ok bool
+	if ss[0][0] == 'P' { // proprietary
+		fmts, ok = fmtPA[ss[0]]
+	} else {
+		fmts, ok = fmtFA[ss[0][2:]]
+	}
 	if ok {
 		if len(ss) < fmts.mf {
-			fmt.Printf("%s: invalid sentence (not enough fields)\n", cleanS(sentence))
+			d.report(cleanS(sentence), fmt.Errorf("%w (%d < %d)", ErrFieldCount, len(ss), fmts.mf))
 		} else {
 //fmt.Printf("Processing %s (%v)\n", ss[0], ss)
-			fmts.fn(ss)
+			if d.curLoc.RxFirst.IsZero() {
+				d.curLoc.RxFirst = d.tRx
+			}
+			d.curLoc.RxLast = d.tRx
+			fmts.fn(d, ss)
 		}
 	} else {
 		//fmt.Printf("Skipping %s\n", ss[0])
@@ -542,11 +1601,48 @@ func processSentence(sentence []byte) {
 
 	// Consider delivering a fix if a cycle has been completed.
 	if eoc { // end of cycle
-		locChan <- getLoc()
+		d.deliver(d.getLoc())
 		//fmt.Println(lastLoc)
 	}
 }
 
+// Deliver a fix on the fixes channel, according to the delivery policy.
+func (d *Decoder) deliver(li *LocInfo) {
+	switch d.delivery {
+	case LOC_DELIVER_DROP_NEWEST:
+		select {
+		case d.fixes <- li:
+		default: // channel full or nobody listening
+			atomic.AddUint64(&d.dropped, 1)
+		}
+
+	case LOC_DELIVER_DROP_OLDEST:
+		for {
+			select {
+			case d.fixes <- li:
+				return
+			default: // make room by discarding the oldest fix
+			}
+			select {
+			case <-d.fixes:
+				atomic.AddUint64(&d.dropped, 1)
+			default: // unbuffered or already emptied by the user
+				if cap(d.fixes) == 0 {
+					atomic.AddUint64(&d.dropped, 1)
+					return
+				}
+			}
+		}
+
+	default: // LOC_DELIVER_BLOCK
+		select {
+		case d.fixes <- li:
+		case <-d.done: // nil (i.e. never ready) unless started by Run
+		case <-d.quit:
+		}
+	}
+}
+
 // Feed should be called everytime a chunck of NMEA-183 data has been read
 // from the GNSS serial or USB port.
 //
@@ -554,32 +1650,73 @@ func processSentence(sentence []byte) {
 //
 // Chunck size does not matter: Feed can accept several sentences in a row
 // as well as partial sentences.
-func Feed(data []byte) {
+//
+// The data is assumed to be received at the time given by the Clock of
+// the decoder.
+func (d *Decoder) Feed(data []byte) {
+	d.FeedAt(data, d.clock.Now())
+}
+
+// FeedAt is like Feed but the data is assumed to be received at time t.
+// It is typically used to replay NMEA logs recorded with their capture
+// timestamps, in which case the decoder should be given a custom Clock
+// so that timing decisions only depend on the recorded timestamps.
+func (d *Decoder) FeedAt(data []byte, t time.Time) {
 	var i int
 	//fmt.Printf("Feed('%s'", data)
 
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	defer d.arm() // wait for more data or for the quiet period
+
+	// Deliver the pending fix if the stream has been quiet for too long.
+	if d.quiet != 0 && !d.tPrev.IsZero() && t.Sub(d.tPrev) >= d.quiet {
+		d.flush()
+	}
+	d.tRx = t
+
 	for len(data) != 0 {
-		switch feedState {
+		switch d.feedState {
 		case 0: // waiting for '$'
 			if i = strings.IndexByte(string(data), '$'); i == -1 {
 				return // ignore this data chunk
 			}
 			data = data[i:] // what's left
-			feedState = 1	// wait for LF now
+			d.feedState = 1	// wait for LF now
 
 		case 1: // waiting for LF
 			if i = strings.IndexByte(string(data), '\n'); i == -1 {
-				feedBuf = append(feedBuf, data...) // append this chunk to the temporary buffer
+				d.feedBuf = append(d.feedBuf, data...) // append this chunk to the temporary buffer
 				return		// stay in state 1
 			}
-			processSentence(append(feedBuf, data[:i+1]...)) // got a sentence
-			feedBuf = feedBuf[:0]	// clear feedBuf
+			d.processSentence(append(d.feedBuf, data[:i+1]...)) // got a sentence
+			d.feedBuf = d.feedBuf[:0]	// clear feedBuf
 			data = data[i+1:]		// go on with what's left
-			feedState = 0			// waiting for '$' now
+			d.feedState = 0			// waiting for '$' now
 		}
 	}
 }
 
+// Write implements the io.Writer interface by feeding the decoder with p,
+// so that a GNSS stream can be decoded with io.Copy(d, serial).
+// Write always returns len(p), nil.
+func (d *Decoder) Write(p []byte) (int, error) {
+	d.Feed(p)
+	return len(p), nil
+}
+
+// Feed feeds the default decoder set up by Init.
+// See Decoder.Feed for details.
+func Feed(data []byte) {
+	defaultDecoder.Feed(data)
+}
+
+// FeedAt feeds the default decoder set up by Init with data received at
+// time t. See Decoder.FeedAt for details.
+func FeedAt(data []byte, t time.Time) {
+	defaultDecoder.FeedAt(data, t)
+}
+
 // Init initializes the communication channel used to deliver compiled GNSS
 // fixes to the package user.
 //
@@ -598,23 +1735,25 @@ func Feed(data []byte) {
 // 4 consecutive exceedances of the minimal inter-cycle delay, coming after
 // sentences of the same type.
 //
+// Init, Feed and Exit operate on a default Decoder held by the package.
+// Programs that need to decode several streams should use NewDecoder
+// instead.
+//
 // Init returns the initialized channel.
 func Init(lsdt string, minDelay uint) chan *LocInfo {
-	lst = lsdt
-	
-	if minDelay == 0 {
-		minDel = time.Duration(300) * time.Millisecond	// default to 300 ms
-	} else {
-		minDel = time.Duration(minDelay) * time.Millisecond // convert ms to ns
-	}
+	return InitOptions(Options{Lsdt: lsdt, MinDelay: minDelay})
+}
 
-	locChan = make(chan *LocInfo)
+// InitOptions is like Init but gives access to all the options of the
+// default decoder, such as the OnError handler.
+func InitOptions(opts Options) chan *LocInfo {
+	defaultDecoder = NewDecoder(opts)
 	//fmt.Println("loc.Init() done")
-	return locChan
+	return defaultDecoder.fixes
 }
 
 // Exit undo what Init did.
 func Exit() {
-	close(locChan)
+	defaultDecoder.Close()
 	//fmt.Println("loc.Exit() done")
 }
@@ -0,0 +1,273 @@
+package loc
+
+import (
+	"fmt"
+	"math"
+	"testing"
+	"time"
+)
+
+// Build a complete NMEA sentence from its body (without '$' and checksum).
+func nmea(body string) string {
+	var cs byte
+	for i := 0; i < len(body); i++ {
+		cs ^= body[i]
+	}
+	return fmt.Sprintf("$%s*%02X\r\n", body, cs)
+}
+
+// Decode the sentences given by their bodies as a single cycle and return
+// the resulting fix.
+func decode(t *testing.T, bodies ...string) *LocInfo {
+	t.Helper()
+	d := NewDecoder(Options{QuietPeriod: -1, BufSize: 1, OnError: func(err error) { t.Error(err) }})
+	t0 := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i, b := range bodies {
+		d.FeedAt([]byte(nmea(b)), t0.Add(time.Duration(i)*10*time.Millisecond))
+	}
+	d.Flush()
+	select {
+	case li := <-d.Fixes():
+		return li
+	default:
+		t.Fatal("no fix")
+		return nil
+	}
+}
+
+func near(a, b float64) bool {
+	return math.Abs(a-b) < 1e-4
+}
+
+// Two decoders fed concurrently do not share any state.
+func TestDecoders(t *testing.T) {
+	lats := []string{"4807.038,N", "4916.450,S"}
+	want := []float64{48.1173, -49.274167}
+	got := make([]<-chan *LocInfo, len(lats))
+	for i, lat := range lats {
+		d := NewDecoder(Options{Lsdt: "GPRMC"})
+		got[i] = d.Fixes()
+		go func(lat string) {
+			defer d.Close()
+			for s := 0; s < 3; s++ {
+				d.Feed([]byte(nmea(fmt.Sprintf("GPRMC,1235%02d,A,%s,01131.000,E,022.4,084.4,230394,003.1,W", s, lat))))
+			}
+		}(lat)
+	}
+	for i, fixes := range got {
+		n := 0
+		for li := range fixes {
+			if !near(li.Lat, want[i]) || li.Utc.Second != uint16(n) {
+				t.Errorf("decoder %d: got fix %d at %v, %+v", i, n, li.Lat, li.Utc)
+			}
+			n++
+		}
+		if n != 3 {
+			t.Errorf("decoder %d: got %d fixes, want 3", i, n)
+		}
+	}
+}
+
+// Satellite IDs up to LOC_MAXSATID are accepted.
+func TestSatID(t *testing.T) {
+	d := NewDecoder(Options{Lsdt: "GAGSV"})
+	go func() {
+		d.Feed([]byte(nmea("GNGSA,A,3,301,,,,,,,,,,,,2.5,1.3,2.1")))
+		d.Feed([]byte(nmea("GAGSV,1,1,02,301,40,083,46,336,20,280,38")))
+	}()
+	li := <-d.Fixes()
+	if len(li.Sats) != 2 || li.Sats[0].Id != 301 || !li.Sats[0].Inuse || li.Sats[1].Id != 336 || li.Sats[1].Inuse {
+		t.Errorf("got satellites %+v", li.Sats)
+	}
+}
+
+func TestParseUtc(t *testing.T) {
+	tests := []struct {
+		in   string
+		ok   bool
+		want LocTime // Hour, Minute, Second and Ms only
+	}{
+		{"123519", true, LocTime{Hour: 12, Minute: 35, Second: 19}},
+		{"123519.00", true, LocTime{Hour: 12, Minute: 35, Second: 19}},
+		{"123519.5", true, LocTime{Hour: 12, Minute: 35, Second: 19, Ms: 500}},
+		{"123519.123456", true, LocTime{Hour: 12, Minute: 35, Second: 19, Ms: 123}},
+		{"235960", true, LocTime{Hour: 23, Minute: 59, Second: 60}}, // leap second
+		{"", false, LocTime{}},
+		{"12351", false, LocTime{}},
+		{"1235190", false, LocTime{}},
+		{"243519", false, LocTime{}},
+		{"126019", false, LocTime{}},
+		{"12a519", false, LocTime{}},
+		{"123519.x", false, LocTime{}},
+	}
+	for _, tt := range tests {
+		var got LocTime
+		if ok := parseUtc(tt.in, &got); ok != tt.ok || got != tt.want {
+			t.Errorf("parseUtc(%q) = %v, %+v; want %v, %+v", tt.in, ok, got, tt.ok, tt.want)
+		}
+	}
+}
+
+func TestParseDate(t *testing.T) {
+	tests := []struct {
+		in   string
+		ok   bool
+		want LocTime // Year, Month, Day and Dow only
+	}{
+		{"230394", true, LocTime{Year: 1994, Month: 3, Day: 23, Dow: 3}},
+		{"010100", true, LocTime{Year: 2000, Month: 1, Day: 1, Dow: 6}},
+		{"060180", true, LocTime{Year: 1980, Month: 1, Day: 6, Dow: 0}},
+		{"311279", true, LocTime{Year: 2079, Month: 12, Day: 31, Dow: 0}},
+		{"", false, LocTime{}},
+		{"2303941", false, LocTime{}},
+		{"320394", false, LocTime{}},
+		{"231394", false, LocTime{}},
+		{"000394", false, LocTime{}},
+		{"2303a4", false, LocTime{}},
+	}
+	for _, tt := range tests {
+		var got LocTime
+		if ok := parseDate(tt.in, &got); ok != tt.ok || got != tt.want {
+			t.Errorf("parseDate(%q) = %v, %+v; want %v, %+v", tt.in, ok, got, tt.ok, tt.want)
+		}
+	}
+}
+
+func TestLocTime(t *testing.T) {
+	lt := LocTime{Year: 2024, Month: 2, Day: 29, Dow: 4, Hour: 23, Minute: 59, Second: 59, Ms: 250}
+	tm := lt.Time()
+	if want := time.Date(2024, 2, 29, 23, 59, 59, 250e6, time.UTC); !tm.Equal(want) {
+		t.Errorf("Time() = %v, want %v", tm, want)
+	}
+	if got := NewLocTime(tm); got != lt {
+		t.Errorf("NewLocTime() = %+v, want %+v", got, lt)
+	}
+	if !(LocTime{Hour: 12}).Time().IsZero() {
+		t.Error("Time() of a LocTime without date is not zero")
+	}
+}
+
+func TestSentences(t *testing.T) {
+	tests := []struct {
+		name   string
+		bodies []string
+		check  func(li *LocInfo) bool
+	}{
+		{"GGA", []string{"GPGGA,123519,4807.038,N,01131.000,E,1,08,0.9,545.4,M,46.9,M,,"}, func(li *LocInfo) bool {
+			return near(li.Lat, 48.1173) && near(li.Lon, 11.516667) && li.Quality == LOC_SIG_GPS &&
+				li.NumUsed == 8 && near(float64(li.Hdop), 0.9) && near(li.Elv, 545.4) &&
+				near(li.GeoidSep, 46.9) && near(li.EllipsoidalHeight, 592.3) &&
+				li.Utc.Hour == 12 && li.Utc.Minute == 35 && li.Utc.Second == 19 &&
+				near(float64(li.HorizontalAccuracy), 4.5) && li.HasAccuracy() && li.Has3D() && li.Level == LOC_HAVE_ALTITUDE &&
+				li.Valid == LOC_VALID_TIME|LOC_VALID_LATLON|LOC_VALID_ALT|LOC_VALID_HDOP|LOC_VALID_NUMUSED|
+					LOC_VALID_GEOIDSEP|LOC_VALID_ELLIPSOIDAL|LOC_VALID_HACC
+		}},
+		{"GGA without fix", []string{"GNGGA,,,,,,0,00,99.99,,,,,,"}, func(li *LocInfo) bool {
+			return li.Quality == LOC_SIG_BAD && li.HorizontalAccuracy == 0 && !li.HasAccuracy() && !li.Has2D()
+		}},
+		{"GGA DGPS", []string{"GPGGA,123519,4807.038,N,01131.000,E,2,08,0.9,545.4,M,,M,1.2,0031"}, func(li *LocInfo) bool {
+			return near(float64(li.DiffAge), 1.2) && li.DiffStation == 31 &&
+				li.Valid == LOC_VALID_TIME|LOC_VALID_LATLON|LOC_VALID_ALT|LOC_VALID_HDOP|LOC_VALID_NUMUSED|
+					LOC_VALID_DIFFAGE|LOC_VALID_DIFFSTATION|LOC_VALID_HACC
+		}},
+		{"GGA RTK", []string{"GNGGA,123519,4807.038,N,01131.000,E,4,12,0.5,545.4,M,46.9,M,1.0,0000"}, func(li *LocInfo) bool {
+			return li.Quality == LOC_SIG_RTK && li.Quality.IsFix()
+		}},
+		{"GGA simulator", []string{"GPGGA,123519,4807.038,N,01131.000,E,8,08,0.9,545.4,M,46.9,M,,", "GPRMC,123519,A,4807.038,N,01131.000,E,022.4,084.4,230394,003.1,W"}, func(li *LocInfo) bool {
+			return li.Quality == LOC_SIG_SIM && !li.Quality.IsFix() && !li.Has2D() && li.Level == LOC_HAVE_TIME
+		}},
+		{"RMC", []string{"GPRMC,123519,A,4807.038,N,01131.000,E,022.4,084.4,230394,003.1,W"}, func(li *LocInfo) bool {
+			return near(li.Lat, 48.1173) && near(float64(li.Speed), 22.4*1.852) && near(float64(li.Heading), 84.4) &&
+				near(float64(li.Mv), -3.1) && li.Utc.Year == 1994 && li.Utc.Month == 3 && li.Utc.Day == 23 &&
+				li.Quality == LOC_SIG_GPS && li.NavMode == LOC_FIX_2D && li.Level == LOC_HAVE_POSITION && !li.Unsafe &&
+				li.HasDate() && li.HasVelocity() &&
+				li.Valid&(LOC_VALID_TIME|LOC_VALID_DATE|LOC_VALID_LATLON|LOC_VALID_MV|LOC_VALID_ALT) == LOC_VALID_TIME|LOC_VALID_DATE|LOC_VALID_LATLON|LOC_VALID_MV
+		}},
+		{"RMC void", []string{"GNRMC,,V,,,,,,,,,,N"}, func(li *LocInfo) bool {
+			return li.Quality == LOC_SIG_BAD && li.NavMode == LOC_FIX_BAD && li.Mode == LOC_MODE_NONE && li.Caps == 0 &&
+				li.Valid&(LOC_VALID_TIME|LOC_VALID_DATE|LOC_VALID_LATLON|LOC_VALID_MV) == 0
+		}},
+		{"RMC mode N", []string{"GPRMC,123519,A,4807.038,N,01131.000,E,022.4,084.4,230394,003.1,W,N"}, func(li *LocInfo) bool {
+			return li.Quality == LOC_SIG_BAD && li.NavMode != LOC_FIX_2D && li.Mode == LOC_MODE_NONE && !li.Has2D()
+		}},
+		{"RMC estimated", []string{"GPRMC,123519,A,4807.038,N,01131.000,E,022.4,084.4,230394,003.1,W,E"}, func(li *LocInfo) bool {
+			return li.Quality == LOC_SIG_DR && li.Mode == LOC_MODE_ESTIMATED && li.Unsafe
+		}},
+		{"RMC unsafe", []string{"GNRMC,123519,A,4807.038,N,01131.000,E,022.4,084.4,230394,003.1,W,D,U"}, func(li *LocInfo) bool {
+			return li.Quality == LOC_SIG_DGPS && li.NavStatus == LOC_NAV_UNSAFE && li.Unsafe
+		}},
+		{"GLL", []string{"GPGLL,4916.45,N,12311.12,W,225444,A,A"}, func(li *LocInfo) bool {
+			return near(li.Lat, 49.274167) && near(li.Lon, -123.185333) && li.Quality == LOC_SIG_GPS &&
+				li.Mode == LOC_MODE_AUTONOMOUS && li.Utc.Hour == 22 && li.Smask == GxGLL && li.Has2D()
+		}},
+		{"GLL mode N", []string{"GPGLL,4916.45,N,12311.12,W,225444,A,N"}, func(li *LocInfo) bool {
+			return li.Quality == LOC_SIG_BAD && li.Mode == LOC_MODE_NONE && !li.Has2D()
+		}},
+		{"RMC then empty GLL", []string{"GPRMC,123519,A,4807.038,N,01131.000,E,022.4,084.4,230394,003.1,W", "GPGLL,,,,,123519,V,N"}, func(li *LocInfo) bool {
+			return near(li.Lat, 48.1173) && li.Valid&LOC_VALID_LATLON != 0 && li.Quality == LOC_SIG_BAD && li.Smask == GxRMC|GxGLL
+		}},
+		{"VTG", []string{"GPVTG,054.7,T,034.4,M,005.5,N,010.2,K,A"}, func(li *LocInfo) bool {
+			return near(float64(li.Heading), 54.7) && near(float64(li.MagHeading), 34.4) && near(float64(li.Speed), 10.2) &&
+				li.Valid&(LOC_VALID_SPEED|LOC_VALID_HEADING|LOC_VALID_MAGHEADING) == LOC_VALID_SPEED|LOC_VALID_HEADING|LOC_VALID_MAGHEADING
+		}},
+		{"VTG then RMC", []string{"GPVTG,054.7,T,034.4,M,005.5,N,010.2,K,A", "GPRMC,123519,A,4807.038,N,01131.000,E,022.4,084.4,230394,003.1,W"}, func(li *LocInfo) bool {
+			return near(float64(li.Speed), 10.2) && near(float64(li.Heading), 54.7)
+		}},
+		{"VTG knots", []string{"GPVTG,054.7,T,,M,005.5,N,,K"}, func(li *LocInfo) bool {
+			return near(float64(li.Speed), 5.5*1.852) && li.Valid&LOC_VALID_MAGHEADING == 0
+		}},
+		{"ZDA", []string{"GPZDA,201530.00,04,07,2002,-05,30"}, func(li *LocInfo) bool {
+			return li.Utc == LocTime{Year: 2002, Month: 7, Day: 4, Dow: 4, Hour: 20, Minute: 15, Second: 30} &&
+				li.ZoneHours == -5 && li.ZoneMinutes == -30 && li.Valid&LOC_VALID_ZONE != 0
+		}},
+		{"ZDA then RMC", []string{"GPZDA,123519,24,03,1994,,", "GPRMC,123519,A,4807.038,N,01131.000,E,022.4,084.4,230394,003.1,W"}, func(li *LocInfo) bool {
+			return li.Utc.Day == 24 && li.Valid&LOC_VALID_ZONE == 0
+		}},
+		{"ZDA without date", []string{"GPZDA,123519,,,,,", "GPRMC,123519,A,4807.038,N,01131.000,E,022.4,084.4,230394,003.1,W"}, func(li *LocInfo) bool {
+			return li.Utc.Year == 1994 && li.Utc.Day == 23 && li.HasDate()
+		}},
+		{"GNS", []string{"GNGNS,014035.00,4332.69262,S,17235.48549,E,RR,13,0.9,25.63,11.24,,,S"}, func(li *LocInfo) bool {
+			return near(li.Lat, -43.544877) && li.Mode == LOC_MODE_RTK && li.Quality == LOC_SIG_RTK && li.SysModes == "RR" &&
+				li.NumUsed == 13 && near(li.Elv, 25.63) && near(li.GeoidSep, 11.24) && li.NavStatus == LOC_NAV_SAFE && !li.Unsafe
+		}},
+		{"GNS no fix", []string{"GNGNS,014035.00,,,,,NN,00,,,,,,V"}, func(li *LocInfo) bool {
+			return li.Mode == LOC_MODE_NONE && li.Quality == LOC_SIG_BAD && li.NavStatus == LOC_NAV_NOTVALID
+		}},
+		{"GST", []string{"GPGST,172814.0,0.006,0.023,0.020,273.6,0.023,0.020,0.031"}, func(li *LocInfo) bool {
+			return near(float64(li.Rms), 0.006) && near(float64(li.ErrMajor), 0.023) && near(float64(li.ErrMinor), 0.020) &&
+				near(float64(li.ErrOrient), 273.6) && near(float64(li.SigmaAlt), 0.031) &&
+				near(float64(li.HorizontalAccuracy), math.Hypot(0.023, 0.020)) && near(float64(li.VerticalAccuracy), 0.031)
+		}},
+		{"GGA precision", []string{"GPGGA,123519,4807.0381234,N,01131.0004567,W,1,08,0.9,545.4321,M,46.9,M,,"}, func(li *LocInfo) bool {
+			return math.Abs(li.Lat-(48+7.0381234/60)) < 1e-9 && math.Abs(li.Lon+(11+31.0004567/60)) < 1e-9 && li.Elv == 545.4321
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if li := decode(t, tt.bodies...); !tt.check(li) {
+				t.Errorf("unexpected fix %+v", *li)
+			}
+		})
+	}
+}
+
+func TestFixQuality(t *testing.T) {
+	tests := []struct {
+		q    FixQuality
+		name string
+		fix  bool
+	}{
+		{LOC_SIG_BAD, "invalid", false},
+		{LOC_SIG_GPS, "GPS", true},
+		{LOC_SIG_FRTK, "RTK float", true},
+		{LOC_SIG_DR, "dead reckoning", true},
+		{LOC_SIG_MANUAL, "manual", false},
+		{LOC_SIG_SIM, "simulator", false},
+		{9, "FixQuality(9)", false},
+	}
+	for _, tt := range tests {
+		if name, fix := tt.q.String(), tt.q.IsFix(); name != tt.name || fix != tt.fix {
+			t.Errorf("FixQuality(%d) = %q, %v; want %q, %v", uint8(tt.q), name, fix, tt.name, tt.fix)
+		}
+	}
+}
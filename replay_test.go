@@ -0,0 +1,149 @@
+package loc
+
+import (
+	"bufio"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// A fake clock, only advanced by the tests.
+type fakeClock struct{ t time.Time }
+
+func (c *fakeClock) Now() time.Time { return c.t }
+
+// Check whether line is the last sentence of a cycle ending with a
+// sentence of type lsdt (the last one of a GSV burst).
+func endsCycle(line, lsdt string) bool {
+	if !strings.HasPrefix(line, "$"+lsdt+",") {
+		return false
+	}
+	f := strings.Split(line, ",")
+	return !strings.HasSuffix(lsdt, "GSV") || f[1] == f[2]
+}
+
+// Replay an NMEA log as if it were received in real time: the sentences of
+// a cycle 10 ms apart and the cycles (ending with lsdt) 1 s apart.
+// Return the fixes and the number of errors.
+func replay(t *testing.T, name, lsdt string, opts Options) ([]*LocInfo, int) {
+	t.Helper()
+	f, err := os.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var nerr int
+	clk := &fakeClock{time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)}
+	opts.Clock = clk
+	opts.BufSize = 1 << 16
+	opts.OnError = func(error) { nerr++ }
+	d := NewDecoder(opts)
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		line := sc.Text()
+		d.FeedAt([]byte(line+"\r\n"), clk.Now())
+		clk.t = clk.t.Add(10 * time.Millisecond)
+		if endsCycle(line, lsdt) {
+			clk.t = clk.t.Add(time.Second)
+		}
+	}
+	d.Flush()
+	d.Close()
+
+	var fixes []*LocInfo
+	for li := range d.Fixes() {
+		fixes = append(fixes, li)
+	}
+	return fixes, nerr
+}
+
+func TestReplay(t *testing.T) {
+	logs := []struct {
+		name string
+		lsdt string // last sentence of the cycles
+		nerr int    // corrupted sentences of the log
+	}{
+		{"NMEA1.LOG", "GPVTG", 0},
+		{"NMEA2.LOG", "GPGSV", 1},
+		{"NMEA3.LOG", "GPRMC", 0},
+		{"NMEA4.LOG", "PGRMM", 1},
+		{"NMEA6.LOG", "GNGLL", 47}, // empty GLGSV satellite IDs
+	}
+	for _, l := range logs {
+		t.Run(l.name, func(t *testing.T) {
+			name := "examples/feed/" + l.name
+			data, err := os.ReadFile(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// Count the cycles (including a trailing incomplete one) and the
+			// distinct UTC times of the log.
+			var cycles, epochs int
+			var pending bool
+			epoch := -1
+			for _, line := range strings.Split(string(data), "\n") {
+				line = strings.TrimRight(line, "\r")
+				if line == "" {
+					continue
+				}
+				pending = !endsCycle(line, l.lsdt)
+				if !pending {
+					cycles++
+				}
+				f := strings.Split(line, ",")
+				var stm LocTime
+				if len(f) > 1 && (strings.HasSuffix(f[0], "GGA") || strings.HasSuffix(f[0], "RMC")) && parseUtc(f[1], &stm) {
+					if ms := ((int(stm.Hour)*60+int(stm.Minute))*60+int(stm.Second))*1000 + int(stm.Ms); ms != epoch {
+						epochs++
+						epoch = ms
+					}
+				}
+			}
+			if pending {
+				cycles++
+			}
+
+			// With a known lsdt, every cycle gives a fix.
+			fixes, nerr := replay(t, name, l.lsdt, Options{Lsdt: l.lsdt})
+			if nerr != l.nerr {
+				t.Errorf("got %d errors, want %d", nerr, l.nerr)
+			}
+			if len(fixes) != cycles {
+				t.Errorf("got %d fixes with lsdt %s, want %d", len(fixes), l.lsdt, cycles)
+			}
+			var level uint8
+			for i, li := range fixes {
+				if li.Level > level {
+					level = li.Level
+				}
+				if li.RxFirst.After(li.RxLast) || (i > 0 && !fixes[i-1].RxLast.Before(li.RxFirst)) {
+					t.Fatalf("fix %d: unexpected reception times %v - %v", i, li.RxFirst, li.RxLast)
+				}
+			}
+			if level != LOC_HAVE_SATELLITES {
+				t.Errorf("got level %d, want %d", level, LOC_HAVE_SATELLITES)
+			}
+
+			// Otherwise, the inter-cycle delays give the same cycles.
+			fixes, _ = replay(t, name, l.lsdt, Options{})
+			if len(fixes) != cycles {
+				t.Errorf("got %d fixes with delays, want %d", len(fixes), cycles)
+			}
+
+			// The UTC time gives one cycle per epoch, whatever the delays.
+			fixes, _ = replay(t, name, l.lsdt, Options{Cycle: LOC_CYCLE_TIMESTAMP})
+			if len(fixes) != epochs {
+				t.Errorf("got %d fixes with timestamps, want %d", len(fixes), epochs)
+			}
+
+			// Both are used by the hybrid strategy.
+			fixes, _ = replay(t, name, l.lsdt, Options{Lsdt: l.lsdt, Cycle: LOC_CYCLE_HYBRID})
+			if n := len(fixes); n < cycles || n < epochs || n > cycles+epochs {
+				t.Errorf("got %d fixes with the hybrid strategy for %d cycles and %d epochs", n, cycles, epochs)
+			}
+		})
+	}
+}
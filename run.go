@@ -0,0 +1,57 @@
+package loc
+
+import (
+	"context"
+	"io"
+)
+
+// Run decodes the NMEA-0183 stream read from r until EOF, a read error or
+// the cancellation of ctx, then closes the decoder. The fixes are delivered
+// on the channel returned by Fixes, as with Feed, so the decoder remains
+// available for Dropped or Rate.
+//
+// Run returns a channel on which a read error other than io.EOF is
+// reported. It is closed when Run is over.
+//
+// The stream is read by a goroutine started by Run. As a Read cannot be
+// interrupted, the cancellation of ctx is only noticed when the current
+// Read returns: callers that need a prompt exit should close r as well.
+// The decoder must not be fed by other means while Run is active.
+func (d *Decoder) Run(ctx context.Context, r io.Reader) <-chan error {
+	d.done = ctx.Done()
+	errc := make(chan error, 1) // never block on error reporting
+
+	go func() {
+		defer close(errc)
+		defer d.Close()
+
+		buf := make([]byte, 1024)
+		for ctx.Err() == nil {
+			n, err := r.Read(buf)
+			if n > 0 {
+				d.Feed(buf[:n])
+			}
+			if err == io.EOF {
+				d.Flush() // deliver the last fix
+				return
+			}
+			if err != nil {
+				if ctx.Err() == nil { // not caused by a cancellation
+					errc <- err
+				}
+				return
+			}
+		}
+	}()
+
+	return errc
+}
+
+// Run is like Decoder.Run for a new Decoder configured by opts.
+// It returns the channel on which the fixes are delivered and the channel
+// on which a read error is reported. Both channels are closed when Run is
+// over.
+func Run(ctx context.Context, r io.Reader, opts Options) (<-chan *LocInfo, <-chan error) {
+	d := NewDecoder(opts)
+	return d.fixes, d.Run(ctx, r)
+}
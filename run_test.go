@@ -0,0 +1,89 @@
+package loc
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+// Return a stream of n cycles.
+func stream(n int) string {
+	var sb strings.Builder
+	for s := 0; s < n; s++ {
+		sb.WriteString(strings.Join(cycle(s), ""))
+	}
+	return sb.String()
+}
+
+func TestRun(t *testing.T) {
+	fixes, errc := Run(context.Background(), strings.NewReader(stream(3)), Options{Lsdt: "GPGSA"})
+	n := 0
+	for li := range fixes {
+		if li.Utc.Second != uint16(n) {
+			t.Errorf("got fix %d at %+v", n, li.Utc)
+		}
+		n++
+	}
+	if n != 3 {
+		t.Errorf("got %d fixes, want 3", n)
+	}
+	if err := <-errc; err != nil {
+		t.Errorf("got error %v", err)
+	}
+}
+
+// A reader failing after the data of r.
+type failReader struct{ r io.Reader }
+
+var errRead = errors.New("read error")
+
+func (f failReader) Read(p []byte) (int, error) {
+	n, err := f.r.Read(p)
+	if err == io.EOF {
+		err = errRead
+	}
+	return n, err
+}
+
+func TestRunError(t *testing.T) {
+	d := NewDecoder(Options{Lsdt: "GPGSA", BufSize: 1, Delivery: LOC_DELIVER_DROP_NEWEST})
+	errc := d.Run(context.Background(), failReader{strings.NewReader(stream(3))})
+	if err := <-errc; err != errRead {
+		t.Errorf("got error %v, want %v", err, errRead)
+	}
+	n := 0
+	for range d.Fixes() {
+		n++
+	}
+	if n != 1 || d.Dropped() != 2 {
+		t.Errorf("got %d fixes and %d dropped, want 1 and 2", n, d.Dropped())
+	}
+}
+
+// The cancellation of the context releases a blocked delivery.
+func TestRunCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	d := NewDecoder(Options{Lsdt: "GPGSA"})
+	errc := d.Run(ctx, strings.NewReader(stream(3)))
+	<-d.Fixes()
+	cancel()
+	if err := <-errc; err != nil {
+		t.Errorf("got error %v", err)
+	}
+	for range d.Fixes() { // closed by Run
+	}
+}
+
+// The pending fix is delivered at EOF.
+func TestRunFlush(t *testing.T) {
+	fixes, _ := Run(context.Background(), strings.NewReader(stream(1)), Options{Lsdt: "GPGSV", QuietPeriod: -1})
+	n := 0
+	for range fixes {
+		n++
+	}
+	if n != 1 {
+		t.Errorf("got %d fixes, want 1", n)
+	}
+}
@@ -0,0 +1,200 @@
+package loc
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// u-blox proprietary information, given by the PUBX,00 (POSITION),
+// PUBX,03 (SVSTATUS) and PUBX,04 (TIME) sentences.
+//
+// The fields are only meaningful when the matching sentence has been
+// received during the cycle (see the PUBXxx bits of LocInfo.Smask and the
+// LOC_VALID_XXX bits of LocInfo.Valid).
+type LocUbx struct {
+	NavStat string  // Navigation status, e.g. "G3" or "D3" (PUBX,00)
+	HAcc    float32 // Horizontal accuracy estimate in meters (PUBX,00)
+	VAcc    float32 // Vertical accuracy estimate in meters (PUBX,00)
+	VVel    float32 // Vertical velocity in m/s, positive downwards (PUBX,00)
+	Tdop    float32 // Time Dilution Of Precision (PUBX,00)
+
+	Sats []UbxSat // Satellite status (PUBX,03)
+
+	UtcTow         float64 // UTC time of week in seconds (PUBX,04)
+	UtcWeek        uint16  // UTC week number (PUBX,04)
+	LeapSec        int8    // Leap seconds (PUBX,04)
+	LeapSecDefault bool    // LeapSec is the firmware default, not yet received from the satellites
+	ClkBias        float64 // Receiver clock bias in ns (PUBX,04)
+	ClkDrift       float32 // Receiver clock drift in ns/s (PUBX,04)
+	TpGran         int32   // Time pulse granularity in ns (PUBX,04)
+}
+
+// Status of a satellite, as given by PUBX,03.
+type UbxSat struct {
+	Id      uint16 // Satellite ID
+	Status  byte   // 'U' = used in solution, 'e' = ephemeris available but not used, '-' = not used
+	Azimuth uint16 // Azimuth in degrees
+	Elv     uint8  // Elevation in degrees
+	Cno     uint8  // Signal strength (C/N0) in dBHz
+	Lock    uint8  // Carrier lock time in seconds (0 - 64)
+}
+
+// u-blox navigation status (PUBX,00) to quality and navigation mode.
+var ubxNavStat = map[string]struct {
+	q FixQuality
+	n uint8
+}{
+	"NF": {LOC_SIG_BAD, LOC_FIX_BAD}, // no fix
+	"DR": {LOC_SIG_DR, LOC_FIX_2D},   // dead reckoning only
+	"G2": {LOC_SIG_GPS, LOC_FIX_2D},  // stand alone 2D
+	"G3": {LOC_SIG_GPS, LOC_FIX_3D},  // stand alone 3D
+	"D2": {LOC_SIG_DGPS, LOC_FIX_2D}, // differential 2D
+	"D3": {LOC_SIG_DGPS, LOC_FIX_3D}, // differential 3D
+	"RK": {LOC_SIG_GPS, LOC_FIX_3D},  // combined GPS + dead reckoning
+	"TT": {LOC_SIG_BAD, LOC_FIX_BAD}, // time only
+}
+
+// PUBX: u-blox proprietary messages
+// The message ID (second field) selects the actual message.
+func (d *Decoder) doPUBX(fields []string) {
+	var nf int // minimal number of fields
+	var fn func(*Decoder, []string)
+	switch fields[1] {
+	case "00":
+		nf, fn = 19, (*Decoder).doPUBX00
+	case "03":
+		nf, fn = 3, (*Decoder).doPUBX03
+	case "04":
+		nf, fn = 10, (*Decoder).doPUBX04
+	default: // unsupported message
+		return
+	}
+	if len(fields) < nf {
+		d.report(joinS(fields), fmt.Errorf("%w: %d < %d", ErrFieldCount, len(fields), nf))
+		return
+	}
+	fn(d, fields)
+}
+
+// PUBX,00: u-blox position
+func (d *Decoder) doPUBX00(fields []string) {
+	d.setUtc(fields[2]) // hhmmss.ss
+	d.setLatLon(fields, 3)
+	if h, ok := parseF(fields, 7); ok { // altitude above the user datum ellipsoid
+		d.curLoc.EllipsoidalHeight = h
+		d.curLoc.Valid |= LOC_VALID_ELLIPSOIDAL
+	}
+
+	u := &d.curLoc.Ubx
+	u.NavStat = fields[8]
+	if ns, ok := ubxNavStat[u.NavStat]; ok && d.curLoc.Smask&(GxGGA|GxGNS) == 0 { // GGA and GNS come first
+		d.curLoc.Quality = ns.q
+		d.curLoc.NavMode = ns.n
+	}
+	if a, ok := parseF(fields, 9); ok {
+		u.HAcc = float32(a)
+		d.curLoc.Valid |= LOC_VALID_UBX_HACC
+	}
+	if a, ok := parseF(fields, 10); ok {
+		u.VAcc = float32(a)
+		d.curLoc.Valid |= LOC_VALID_UBX_VACC
+	}
+
+	d.setVelocity(fields, 11, 1) // speed over ground (km/h)
+	if v, ok := parseF(fields, 13); ok {
+		u.VVel = float32(v)
+		d.curLoc.Valid |= LOC_VALID_VVEL
+	}
+
+	if a, ok := parseF(fields, 14); ok { // age of differential corrections
+		d.curLoc.DiffAge = float32(a)
+		d.curLoc.Valid |= LOC_VALID_DIFFAGE
+	}
+
+	if d.curLoc.Smask&GxGSA == 0 { // DOPs, unless given by GSA
+		d.setDOP(fields, 15, &d.curLoc.Hdop, LOC_VALID_HDOP)
+		d.setDOP(fields, 16, &d.curLoc.Vdop, LOC_VALID_VDOP)
+	}
+	if t, ok := parseF(fields, 17); ok {
+		u.Tdop = float32(t)
+	}
+	if n, err := strconv.Atoi(fields[18]); err == nil && n >= 0 { // satellites used
+		d.curLoc.NumUsed = uint8(n)
+		d.curLoc.Valid |= LOC_VALID_NUMUSED
+	}
+
+	d.curLoc.Smask |= PUBX00
+}
+
+// PUBX,03: u-blox satellite status
+// As the list of satellites is complete, it replaces the one built from GSV.
+func (d *Decoder) doPUBX03(fields []string) {
+	n, err := strconv.Atoi(fields[2]) // number of satellites tracked
+	if err != nil || n < 0 || n > (len(fields)-3)/6 {
+		d.report(joinS(fields), fmt.Errorf("%w: %d fields for %s satellites", ErrFieldCount, len(fields), fields[2]))
+		return
+	}
+
+	us := make([]UbxSat, 0, n)
+	sats := make([]LocSat, 0, n)
+	for i := 0; i < n; i++ {
+		f := fields[3+i*6 : 3+i*6+6]
+		sv, _ := strconv.Atoi(f[0]) // satellite ID
+		if sv <= 0 || uint(sv) > LOC_MAXSATID {
+			d.report(joinS(fields), fmt.Errorf("%w: %02d", ErrSatID, sv))
+			return
+		}
+		az, _ := strconv.Atoi(f[2])  // azimuth
+		elv, _ := strconv.Atoi(f[3]) // elevation
+		cno, _ := strconv.Atoi(f[4]) // signal strength
+		lck, _ := strconv.Atoi(f[5]) // carrier lock time
+
+		s := UbxSat{Id: uint16(sv), Status: '-', Azimuth: uint16(az), Elv: uint8(elv), Cno: uint8(cno), Lock: uint8(lck)}
+		if len(f[1]) == 1 {
+			s.Status = f[1][0]
+		}
+		us = append(us, s)
+		ls := LocSat{Id: s.Id, Elv: s.Elv, Azimuth: s.Azimuth, Sig: s.Cno, Inuse: s.Status == 'U'}
+		ls.Constellation, ls.Prn = satPrn(LOC_GNSS_UNKNOWN, sv) // extended numbering
+		sats = append(sats, ls)
+	}
+	d.curLoc.Ubx.Sats = us
+	d.curLoc.Sats = sats
+
+	d.curLoc.Smask |= PUBX03
+}
+
+// PUBX,04: u-blox time of day and clock information
+func (d *Decoder) doPUBX04(fields []string) {
+	d.setUtc(fields[2]) // hhmmss.ss
+	if !d.zdaDate {     // prefer the 4-digit year of ZDA
+		d.setDate(fields[3]) // ddmmyy
+	}
+
+	u := &d.curLoc.Ubx
+	if tow, ok := parseF(fields, 4); ok {
+		u.UtcTow = tow
+	}
+	if wk, err := strconv.Atoi(fields[5]); err == nil && wk >= 0 {
+		u.UtcWeek = uint16(wk)
+	}
+	leap := strings.TrimSuffix(fields[6], "D") // 'D' when the firmware default is used
+	if ls, err := strconv.Atoi(leap); err == nil {
+		u.LeapSec = int8(ls)
+		u.LeapSecDefault = leap != fields[6]
+		d.curLoc.Valid |= LOC_VALID_LEAPSEC
+	}
+	bias, okb := parseF(fields, 7)
+	drift, okd := parseF(fields, 8)
+	if okb && okd {
+		u.ClkBias = bias
+		u.ClkDrift = float32(drift)
+		d.curLoc.Valid |= LOC_VALID_CLOCK
+	}
+	if g, err := strconv.Atoi(fields[9]); err == nil {
+		u.TpGran = int32(g)
+	}
+
+	d.curLoc.Smask |= PUBX04
+}
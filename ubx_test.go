@@ -0,0 +1,83 @@
+package loc
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestPUBX(t *testing.T) {
+	li := decode(t, "PUBX,00,081350.00,4717.113210,N,00833.915187,E,546.589,G3,2.1,2.0,0.007,77.52,0.007,,0.92,1.19,0.77,9,0,0")
+	u := li.Ubx
+	if u.NavStat != "G3" || li.Quality != LOC_SIG_GPS || li.NavMode != LOC_FIX_3D || !near(li.EllipsoidalHeight, 546.589) ||
+		u.HAcc != 2.1 || u.VAcc != 2.0 || u.VVel != 0.007 || u.Tdop != 0.77 || li.Hdop != 0.92 || li.Vdop != 1.19 ||
+		li.NumUsed != 9 || li.HorizontalAccuracy != 2.1 || li.Speed != 0.007 || li.Heading != 77.52 {
+		t.Errorf("PUBX,00: got %+v", *li)
+	}
+
+	li = decode(t, "PUBX,03,2,23,-,,,45,010,29,U,171,67,39,055")
+	if len(li.Ubx.Sats) != 2 || len(li.Sats) != 2 {
+		t.Fatalf("PUBX,03: got %d satellites", len(li.Ubx.Sats))
+	}
+	if s := li.Ubx.Sats[1]; s != (UbxSat{Id: 29, Status: 'U', Azimuth: 171, Elv: 67, Cno: 39, Lock: 55}) {
+		t.Errorf("PUBX,03: got %+v", s)
+	}
+	if li.Sats[0].Inuse || !li.Sats[1].Inuse || li.Sats[1].Constellation != LOC_GNSS_GPS {
+		t.Errorf("PUBX,03: got %+v", li.Sats)
+	}
+
+	li = decode(t, "PUBX,04,073731.00,091202,113851.00,1196,15D,1930035,-2660.664,43,")
+	u = li.Ubx
+	if li.Utc != (LocTime{Year: 2002, Month: 12, Day: 9, Dow: 1, Hour: 7, Minute: 37, Second: 31}) ||
+		u.UtcTow != 113851 || u.UtcWeek != 1196 || u.LeapSec != 15 || !u.LeapSecDefault ||
+		u.ClkBias != 1930035 || u.ClkDrift != -2660.664 || u.TpGran != 43 {
+		t.Errorf("PUBX,04: got %+v", *li)
+	}
+}
+
+func TestPUBX03SatCount(t *testing.T) {
+	for _, body := range []string{
+		"PUBX,03,3074457345618258603,1,2,3", // 6*n overflows
+		"PUBX,03,2,01,U,120,45,40,064",      // fewer fields than announced
+		"PUBX,03,-1",
+	} {
+		var errs []error
+		d := NewDecoder(Options{QuietPeriod: -1, BufSize: 4, OnError: func(err error) { errs = append(errs, err) }})
+		d.FeedAt([]byte(nmea(body)), time.Unix(0, 0))
+		if len(errs) != 1 || !errors.Is(errs[0], ErrFieldCount) {
+			t.Errorf("%s: got errors %v, want %v", body, errs, ErrFieldCount)
+		}
+	}
+}
+
+func TestPUBXCycles(t *testing.T) {
+	for _, opts := range []Options{{}, {Lsdt: "PUBX,04"}, {Cycle: LOC_CYCLE_HYBRID}, {Cycle: LOC_CYCLE_TIMESTAMP}} {
+		clk := &fakeClock{time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)}
+		opts.Clock, opts.BufSize = clk, 20
+		d := NewDecoder(opts)
+		for s := 0; s < 10; s++ {
+			for _, b := range []string{
+				fmt.Sprintf("PUBX,00,0813%02d.00,4717.113210,N,00833.915187,E,546.589,G3,2.1,2.0,0.007,77.52,0.007,,0.92,1.19,0.77,9,0,0", s),
+				"PUBX,03,2,23,-,,,45,010,29,U,171,67,39,055",
+				fmt.Sprintf("PUBX,04,0813%02d.00,091202,113851.00,1196,15D,1930035,-2660.664,43,", s),
+			} {
+				d.FeedAt([]byte(nmea(b)), clk.Now())
+				clk.t = clk.t.Add(10 * time.Millisecond)
+			}
+			clk.t = clk.t.Add(time.Second)
+		}
+		d.Flush()
+		d.Close()
+		n := 0
+		for li := range d.Fixes() {
+			if li.Smask != PUBX00|PUBX03|PUBX04 || li.Utc.Second != uint16(n) {
+				t.Errorf("%+v: fix %d: got Smask %#x at %+v", opts, n, li.Smask, li.Utc)
+			}
+			n++
+		}
+		if n != 10 {
+			t.Errorf("%+v: got %d fixes, want 10", opts, n)
+		}
+	}
+}